@@ -0,0 +1,97 @@
+package parser
+
+// Checkpoint is a saved state of the parser that can be restored via Rollback
+type Checkpoint struct {
+	pos, start, startLine, startPos int
+	width                           int
+	line, linepos                   int
+	linePrev, lineposPrev           int
+	pushback                        []rune
+	ungot                           bool
+	reads                           []virtualRead
+	err                             error
+	astQueue                        []ASTNode
+	nodeStarts                      []Position
+	discarded                       int
+	added                           int
+	atEOF                           bool
+	sourceStack                     []Position
+	tokens                          int
+	errs                            int
+}
+
+// Checkpoint saves the position, the pending span, the error and the astQueue
+func (p *Parser) Checkpoint() Checkpoint {
+	return Checkpoint{
+		pos:         p.pos,
+		start:       p.start,
+		startLine:   p.startLine,
+		startPos:    p.startPos,
+		width:       p.width,
+		line:        p.line,
+		linepos:     p.linepos,
+		linePrev:    p.linePrev,
+		lineposPrev: p.lineposPrev,
+		pushback:    append([]rune(nil), p.pushback...),
+		ungot:       p.ungot,
+		reads:       append([]virtualRead(nil), p.reads...),
+		err:         p.err,
+		astQueue:    append([]ASTNode(nil), p.astQueue...),
+		nodeStarts:  append([]Position(nil), p.nodeStarts...),
+		discarded:   p.discarded,
+		added:       len(p.added),
+		atEOF:       p.atEOF,
+		sourceStack: append([]Position(nil), p.sourceStack...),
+		tokens:      len(p.tokens),
+		errs:        len(p.errs),
+	}
+}
+
+// Rollback restores the state saved by cp
+// the astQueue gets the nodes it had at the checkpoint and nodes added
+// after the checkpoint are removed from their parents, if these are ChildRemovers
+// and nodes replaced via ReplaceCurrent after the checkpoint are put back
+// the tokens recorded (see RecordTokens) and the errors collected (see ErrorfContinue)
+// after the checkpoint are dropped,
+// while calls of the OnEmit hook and tokens sent by RunTokens can't be undone
+// ErrIncomplete is kept (see Feed)
+// for a parser of NewReader, rolling back behind discarded input sets an error
+func (p *Parser) Rollback(cp Checkpoint) {
+	if shift := p.discarded - cp.discarded; shift > 0 {
+		if cp.start < shift {
+			p.Errorf("can't roll back to byte offset %d, the input before %d is discarded", cp.discarded+cp.pos, p.discarded)
+			return
+		}
+		cp.pos, cp.start = cp.pos-shift, cp.start-shift
+		cp.reads = append([]virtualRead(nil), cp.reads...)
+		for i := range cp.reads {
+			cp.reads[i].pos -= shift
+		}
+	}
+	p.pos, p.start, p.startLine, p.startPos = cp.pos, cp.start, cp.startLine, cp.startPos
+	p.width = cp.width
+	p.line, p.linepos = cp.line, cp.linepos
+	p.linePrev, p.lineposPrev = cp.linePrev, cp.lineposPrev
+	p.pushback = append(p.pushback[:0], cp.pushback...)
+	p.ungot = cp.ungot
+	p.reads = append(p.reads[:0], cp.reads...)
+	// more input is needed, whatever was parsed
+	if p.err != ErrIncomplete {
+		p.err = cp.err
+	}
+	p.astQueue = append(p.astQueue[:0], cp.astQueue...)
+	p.nodeStarts = append(p.nodeStarts[:0], cp.nodeStarts...)
+	p.atEOF = cp.atEOF
+	p.sourceStack = append(p.sourceStack[:0], cp.sourceStack...)
+	p.tokens = p.tokens[:min(cp.tokens, len(p.tokens))]
+	p.errs = p.errs[:min(cp.errs, len(p.errs))]
+	for len(p.added) > cp.added {
+		p.added[len(p.added)-1].undo()
+		p.added = p.added[:len(p.added)-1]
+	}
+}
+
+// failed reports whether an error other than ErrEOF and ErrIncomplete is set
+func (p *Parser) failed() bool {
+	return p.err != nil && p.err != ErrEOF && p.err != ErrIncomplete
+}
@@ -0,0 +1,179 @@
+package parser
+
+// SepBy parses any number of items separated by the literal sep and returns
+// the number of parsed items. The State returned by item is ignored.
+// An item fails, if it sets an error. A failed item is rolled back together with
+// the separator before it, so that a trailing separator is left unconsumed for
+// the caller to accept or reject.
+func (p *Parser) SepBy(item State, sep string) int {
+	cp := p.Checkpoint()
+	item(p)
+	if p.failed() {
+		p.Rollback(cp)
+		return 0
+	}
+	return 1 + p.sepByRest(item, sep)
+}
+
+// SepBy1 is like SepBy but requires at least one item
+// the error of a failed first item is kept
+func (p *Parser) SepBy1(item State, sep string) int {
+	item(p)
+	if p.failed() {
+		return 0
+	}
+	return 1 + p.sepByRest(item, sep)
+}
+
+func (p *Parser) sepByRest(item State, sep string) (n int) {
+	for {
+		cp := p.Checkpoint()
+		if !p.acceptLiteral(sep) {
+			return
+		}
+		item(p)
+		if p.failed() {
+			p.Rollback(cp)
+			return
+		}
+		n++
+	}
+}
+
+// acceptLiteral consumes s, if the input continues with it
+func (p *Parser) acceptLiteral(s string) bool {
+	n := p.matchLiteral(s)
+	if s == "" || n < 0 {
+		return false
+	}
+	p.advance(n)
+	return true
+}
+
+// Try runs s and returns the State it returns.
+// s fails, if it sets an error or consumes no input. Then the parser is
+// rolled back and ok is false.
+func (p *Parser) Try(s State) (next State, ok bool) {
+	next, ok, _, _ = p.try(s)
+	return
+}
+
+// try is like Try but also returns the error of a failed s
+// and the offset where it occurred
+func (p *Parser) try(s State) (next State, ok bool, err error, at int) {
+	cp := p.Checkpoint()
+	next = p.call(s)
+	if !p.failed() && p.pos != cp.pos {
+		return next, true, nil, 0
+	}
+	err, at = p.err, p.pos
+	p.Rollback(cp)
+	return nil, false, err, at
+}
+
+// OrElse returns a State that runs primary and, if it fails (see Try),
+// runs fallback instead. The error of primary is cleared before fallback runs.
+// If fallback fails too, the error that occurred further in the input is kept.
+func OrElse(primary, fallback State) State {
+	return func(p *Parser) State {
+		next, ok, err, at := p.try(primary)
+		if ok {
+			return next
+		}
+		next = p.call(fallback)
+		if p.failed() && err != nil && err != ErrEOF && at > p.pos {
+			p.err = err
+		}
+		return next
+	}
+}
+
+// Match is a parsing expression that reports whether it matched.
+// It is regarded as failed, if it returns false or sets an error; then the
+// combinators roll back what it consumed.
+type Match func(p *Parser) bool
+
+// match runs m and rolls it back, if it fails
+func (p *Parser) match(m Match) bool {
+	cp := p.Checkpoint()
+	if m(p) && !p.failed() {
+		return true
+	}
+	p.Rollback(cp)
+	return false
+}
+
+// Text matches the literal s, see AcceptString
+func Text(s string) Match {
+	return func(p *Parser) bool {
+		return p.AcceptString(s)
+	}
+}
+
+// Seq matches all of ms in order
+func Seq(ms ...Match) Match {
+	return func(p *Parser) bool {
+		cp := p.Checkpoint()
+		for _, m := range ms {
+			if !p.match(m) {
+				p.Rollback(cp)
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or matches the first of ms that matches
+func Or(ms ...Match) Match {
+	return func(p *Parser) bool {
+		for _, m := range ms {
+			if p.match(m) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Many matches m as often as possible, also zero times
+// it stops, if m matches without consuming anything
+func Many(m Match) Match {
+	return func(p *Parser) bool {
+		for {
+			begin := p.pos
+			if !p.match(m) || p.pos == begin {
+				return true
+			}
+		}
+	}
+}
+
+// Optional matches m or nothing
+func Optional(m Match) Match {
+	return func(p *Parser) bool {
+		p.match(m)
+		return true
+	}
+}
+
+// Not matches, if m does not match. It never consumes anything.
+func Not(m Match) Match {
+	return func(p *Parser) bool {
+		cp := p.Checkpoint()
+		matched := p.match(m)
+		p.Rollback(cp)
+		return !matched
+	}
+}
+
+// State returns a State that runs m and sets an error, if m fails
+// what describes the expected input in the error message
+func (m Match) State(what string) State {
+	return func(p *Parser) State {
+		if !p.match(m) {
+			p.Errorf("expected %s", what)
+		}
+		return nil
+	}
+}
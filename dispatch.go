@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Dispatcher selects the next State by the input at the current position,
+// see Dispatch. Its method value d.Dispatch is a State itself.
+type Dispatcher struct {
+	literals trieNode
+	classes  []classRoute
+	other    State
+}
+
+// trieNode is a node of the trie of the literals, keyed by runes
+type trieNode struct {
+	next  map[rune]*trieNode
+	last  rune  // the last rune of the literal ending here
+	state State // the state of the literal ending here or nil
+}
+
+type classRoute struct {
+	pred  func(rune) bool
+	state State
+}
+
+// On registers s for the literal, which is consumed before s runs
+func (d *Dispatcher) On(literal string, s State) {
+	n := &d.literals
+	for _, r := range literal {
+		if n.next == nil {
+			n.next = map[rune]*trieNode{}
+		}
+		child, has := n.next[r]
+		if !has {
+			child = &trieNode{}
+			n.next[r] = child
+		}
+		n = child
+	}
+	if n != &d.literals {
+		n.last, _ = utf8.DecodeLastRuneInString(literal)
+		n.state = s
+	}
+}
+
+// OnClass registers s for input starting with a rune satisfying pred,
+// which is not consumed, so that s can scan the whole token
+func (d *Dispatcher) OnClass(pred func(rune) bool, s State) {
+	d.classes = append(d.classes, classRoute{pred, s})
+}
+
+// Otherwise registers s for input that matches neither a literal nor a class
+func (d *Dispatcher) Otherwise(s State) {
+	d.other = s
+}
+
+// Dispatch consumes the longest literal at the current position and returns its
+// state. Like with AcceptKeyword, a literal ending with an identifier rune
+// must not be followed by another one. Without a literal, the state of the first
+// class matching the next rune is returned, then the one given to Otherwise.
+// If none applies, an error is set, except at the end of the input,
+// where Dispatch returns nil.
+func (d *Dispatcher) Dispatch(p *Parser) State {
+	p.skip()
+	var match *trieNode
+	length := 0
+	n := &d.literals
+	for offset := p.pos; n != nil; {
+		if n.state != nil && !p.continuesIdent(n.last, offset) {
+			match, length = n, offset-p.pos
+		}
+		p.fill(offset - p.pos + utf8.UTFMax)
+		if offset >= len(p.input) {
+			break
+		}
+		r, width := utf8.DecodeRuneInString(p.input[offset:])
+		n = n.child(r, p.fold)
+		offset += width
+	}
+	if match != nil {
+		p.advance(length)
+		return match.state
+	}
+	r, ok := p.peek()
+	if ok {
+		for _, c := range d.classes {
+			if c.pred(r) {
+				return c.state
+			}
+		}
+	}
+	if d.other != nil {
+		return d.other
+	}
+	if ok {
+		p.Errorf("unexpected %q", r)
+	}
+	return nil
+}
+
+// child returns the child for r, ignoring the case if fold is set
+func (n *trieNode) child(r rune, fold bool) *trieNode {
+	if c, has := n.next[r]; has || !fold {
+		return c
+	}
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if c, has := n.next[f]; has {
+			return c
+		}
+	}
+	return nil
+}
+
+// continuesIdent reports whether last and the rune at offset are both identifier runes
+func (p *Parser) continuesIdent(last rune, offset int) bool {
+	if !p.identRune(last) {
+		return false
+	}
+	p.fill(offset - p.pos + utf8.UTFMax)
+	next, width := utf8.DecodeRuneInString(p.input[offset:])
+	return width > 0 && p.identRune(next)
+}
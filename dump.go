@@ -0,0 +1,74 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Format is an output format of Dump
+type Format int
+
+const (
+	// FormatJSON writes each node as object with the fields "node" and "children"
+	FormatJSON Format = iota
+	// FormatSExpr writes each node as indented s-expression
+	FormatSExpr
+)
+
+// dumpNode is a node as written by Dump
+type dumpNode struct {
+	Node     string     `json:"node"`
+	Children []dumpNode `json:"children,omitempty"`
+}
+
+// Dump writes the tree below the root in the given format, e.g. for golden file tests.
+// A node is written by its String method, if it is a fmt.Stringer, otherwise by its type.
+// Only the children of ChildrenProviders are written.
+func (p *Parser) Dump(w io.Writer, format Format) error {
+	tree := dumpTree(p.Root())
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(tree)
+	case FormatSExpr:
+		var sb strings.Builder
+		writeSExpr(&sb, tree, 0)
+		sb.WriteString("\n")
+		_, err := io.WriteString(w, sb.String())
+		return err
+	}
+	return fmt.Errorf("unknown format %d", format)
+}
+
+func dumpTree(n ASTNode) dumpNode {
+	d := dumpNode{Node: fmt.Sprintf("%T", n)}
+	if s, ok := n.(fmt.Stringer); ok {
+		d.Node = s.String()
+	}
+	if cp, ok := n.(ChildrenProvider); ok {
+		for _, c := range cp.Children() {
+			d.Children = append(d.Children, dumpTree(c))
+		}
+	}
+	return d
+}
+
+// writeSExpr writes d with its children on the following lines, indented by two spaces per depth
+func writeSExpr(sb *strings.Builder, d dumpNode, depth int) {
+	sb.WriteString("(")
+	if d.Node == "" || strings.ContainsAny(d.Node, " \t\r\n()\"") {
+		sb.WriteString(strconv.Quote(d.Node))
+	} else {
+		sb.WriteString(d.Node)
+	}
+	for _, c := range d.Children {
+		sb.WriteString("\n")
+		sb.WriteString(strings.Repeat("  ", depth+1))
+		writeSExpr(sb, c, depth+1)
+	}
+	sb.WriteString(")")
+}
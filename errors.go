@@ -0,0 +1,66 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ParseError is the error set by Errorf and its variants
+type ParseError struct {
+	Msg     string
+	File    string   // the file of Line and Column, see AddSourceMapping
+	Line    int      // starting with 1
+	Column  int      // in runes, starting with 1
+	Offset  int      // byte offset, starting with 0
+	Context string   // the input around the position
+	States  []string // the running named states, see NameState
+	Err     error    // the error wrapped with %w in the message, if any
+}
+
+func (e *ParseError) Error() string {
+	var while string
+	if len(e.States) > 0 {
+		while = "while parsing " + strings.Join(e.States, " > ") + ": "
+	}
+	var file string
+	if e.File != "" {
+		file = "file " + e.File + ", "
+	}
+	return fmt.Sprintf(
+		"Error in %sline %d at column %d (byte offset %d): %s%s\ncontext:\n%s\n",
+		file,
+		e.Line,
+		e.Column,
+		e.Offset,
+		while,
+		e.Msg,
+		e.Context,
+	)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// newError returns a ParseError for the message of err at pos
+func (p *Parser) newError(pos Position, err error, context string) *ParseError {
+	return &ParseError{
+		Msg:     err.Error(),
+		File:    pos.File,
+		Line:    pos.Line,
+		Column:  pos.Column,
+		Offset:  pos.Offset,
+		Context: context,
+		States:  append([]string(nil), p.states...),
+		Err:     errors.Unwrap(err),
+	}
+}
+
+// Err returns the current error as ParseError or nil, if there is none
+// or it does not come from Errorf or its variants (e.g. ErrEOF)
+func (p *Parser) Err() *ParseError {
+	var pe *ParseError
+	errors.As(p.err, &pe)
+	return pe
+}
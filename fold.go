@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// equalFold reports whether a and b are equal under simple Unicode case folding
+func equalFold(a, b rune) bool {
+	if a == b {
+		return true
+	}
+	for r := unicode.SimpleFold(a); r != a; r = unicode.SimpleFold(r) {
+		if r == b {
+			return true
+		}
+	}
+	return false
+}
+
+// inSet reports whether r is one of the runes in set,
+// ignoring the case, if the parser is case insensitive
+func (p *Parser) inSet(set string, r rune) bool {
+	if !p.fold {
+		return strings.IndexRune(set, r) >= 0
+	}
+	return strings.ContainsFunc(set, func(c rune) bool { return equalFold(c, r) })
+}
+
+// matchLiteral returns the number of bytes of the input at the current position
+// that match s or -1, if the input does not continue with s.
+// The case is ignored, if the parser is case insensitive.
+func (p *Parser) matchLiteral(s string) int {
+	p.skip()
+	// folded runes may differ in length, also leave room for the rune behind s
+	p.fill((len(s) + 1) * utf8.UTFMax)
+	return matchPrefix(p.input[p.pos:], s, p.fold)
+}
+
+// matchPrefix returns the number of bytes of the prefix of in that matches s
+// or -1, if in does not start with s
+func matchPrefix(in, s string, fold bool) int {
+	if !fold {
+		if strings.HasPrefix(in, s) {
+			return len(s)
+		}
+		return -1
+	}
+	n := 0
+	for _, c := range s {
+		r, width := utf8.DecodeRuneInString(in[n:])
+		if width == 0 || !equalFold(c, r) {
+			return -1
+		}
+		n += width
+	}
+	return n
+}
@@ -0,0 +1,46 @@
+package parser
+
+import "errors"
+
+// ErrIncomplete is the error instead of ErrEOF, when the end of the input
+// is reached before Close has been called on a parser that got input via Feed
+var ErrIncomplete = errors.New("incomplete input")
+
+// Feed appends more to the input. After the first call of Feed the end of
+// the input is not final and Run stops with ErrIncomplete at the end of the
+// input, until Close is called. Then Resume goes on with the additional input.
+// Feed must not be called after Close or on a parser of NewReader.
+func (p *Parser) Feed(more string) {
+	p.input += more
+	p.incremental = true
+	p.atEOF = false
+	p.skipped = 0
+}
+
+// Close signals that no more input follows, so the end of the input is final
+func (p *Parser) Close() {
+	p.closed = true
+	if n := len(p.input); p.pos == n && n > 0 && p.input[n-1] == '\r' && p.linepos > 0 {
+		// the undecided \r at the end is a line break now
+		p.line++
+		p.linepos = 0
+	}
+}
+
+// open reports whether more input may follow via Feed
+func (p *Parser) open() bool {
+	return p.incremental && !p.closed
+}
+
+// Resume continues the run that stopped with ErrIncomplete and returns
+// the error of Run. The state that hit the end of the input is rolled back
+// and run again, see Rollback; effects outside of the parser are not undone.
+// Without such a run, Resume does nothing.
+func (p *Parser) Resume() error {
+	fn := p.resume
+	if p.err != ErrIncomplete || fn == nil {
+		return nil
+	}
+	p.err, p.resume = nil, nil
+	return p.Run(fn)
+}
@@ -0,0 +1,129 @@
+package parser
+
+// Option configures a Parser
+type Option func(*Parser)
+
+// WithLoopGuard makes Run abort with an error, if the same state is dispatched
+// more than k times in a row without any progress of the position
+func WithLoopGuard(k int) Option {
+	return func(p *Parser) {
+		p.loopGuard = k
+	}
+}
+
+// WithIdentRune sets the predicate for runes that continue an identifier
+// it is used to check the word boundary behind keywords
+// the default accepts letters, digits and the underscore
+func WithIdentRune(f func(rune) bool) Option {
+	return func(p *Parser) {
+		p.identRune = f
+	}
+}
+
+// WithMaxBytes limits the input that is processed to n bytes
+// reading beyond the limit behaves like the end of the input, but sets an
+// error wrapping ErrMaxBytes
+func WithMaxBytes(n int) Option {
+	return func(p *Parser) {
+		p.maxBytes = n
+	}
+}
+
+// WithMaxRunes limits the number of runes that are read to n, counting runes
+// that are read again after Backup, so that a looping grammar stops.
+// Reading beyond the limit behaves like the end of the input, but sets an
+// error wrapping ErrMaxRunes.
+func WithMaxRunes(n int) Option {
+	return func(p *Parser) {
+		p.maxRunes = n
+	}
+}
+
+// WithMaxDepth limits the length of the astQueue, including the root, to n
+// AddNode sets an error wrapping ErrMaxDepth instead of exceeding it
+func WithMaxDepth(n int) Option {
+	return func(p *Parser) {
+		p.maxDepth = n
+	}
+}
+
+// WithContextWindow sets the number of runes before and after the error
+// position that are shown in the context of errors set by Errorf, default is 5.
+// The context does not reach beyond the line; 0 shows the whole line.
+func WithContextWindow(n int) Option {
+	return func(p *Parser) {
+		p.contextWindow = n
+	}
+}
+
+// WithStrict makes the parser report misuse of its API as error wrapping ErrMisuse,
+// instead of going on: Backup twice without Next in between (Peek and the Accept
+// functions end with a Backup, too), Backup behind the start of the pending emit,
+// Ignore after Next returned EOF and nodes that are not popped when Run returns.
+// The first misuse is set as error and returned by Run.
+func WithStrict() Option {
+	return func(p *Parser) {
+		p.strict = true
+	}
+}
+
+// WithRuneFilter sets a filter for the runes read from the input.
+// Next, Peek and PeekBack and the methods based on them return the filtered runes,
+// while positions and widths refer to the original input. Emit returns the
+// original text, EmitFiltered the filtered one. Methods matching literals
+// or regular expressions work on the original input.
+func WithRuneFilter(f func(rune) rune) Option {
+	return func(p *Parser) {
+		p.filter = f
+	}
+}
+
+// WithOnEmit sets a hook that is called with every emitted token,
+// after the start of the next token has been set
+// the calls are not undone by Rollback, e.g. for a failed alternative of OrElse
+func WithOnEmit(f func(Token)) Option {
+	return func(p *Parser) {
+		p.onEmit = f
+	}
+}
+
+// WithMaxLines limits the input that is processed to n lines
+// reading beyond the line break of the last line behaves like the end of
+// the input, but sets an error wrapping ErrMaxLines
+func WithMaxLines(n int) Option {
+	return func(p *Parser) {
+		p.maxLines = n
+	}
+}
+
+// WithRejectInvalidCodepoints makes Next set an error, when it reads a
+// surrogate (U+D800 to U+DFFF) or a noncharacter (U+FDD0 to U+FDEF and
+// the last two code points of each plane)
+func WithRejectInvalidCodepoints() Option {
+	return func(p *Parser) {
+		p.rejectInvalid = true
+	}
+}
+
+// WithBase sets the line and column (both starting with 1) of the start of the input,
+// e.g. when the input is part of a larger text
+func WithBase(line, column int) Option {
+	return func(p *Parser) {
+		p.baseLine, p.baseCol = line-1, column-1
+		p.firstLine = p.baseLine
+		p.line, p.linepos = p.baseLine, p.baseCol
+		p.startLine, p.startPos = p.baseLine, p.baseCol
+		p.linePrev, p.lineposPrev = p.baseLine, p.baseCol
+	}
+}
+
+// WithCaseInsensitive makes the parser ignore the case, when it compares the
+// input with runes and literals, e.g. in Accept, AcceptRune, AcceptRun,
+// ForwardUntil and AcceptKeyword and therefore also in ExpectRune. Runes are
+// compared with simple Unicode case folding (unicode.SimpleFold), literals rune by rune.
+// Emitted texts keep the case of the input.
+func WithCaseInsensitive() Option {
+	return func(p *Parser) {
+		p.fold = true
+	}
+}
@@ -5,9 +5,14 @@ parser inspired by Rob Pikes lexer
 package parser
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"iter"
+	"regexp"
 	"strings"
+	"unicode"
 	"unicode/utf8"
 )
 
@@ -18,21 +23,160 @@ var ErrEOF = errors.New("End of File")
 
 var EOF = rune('∎')
 
+// ErrMaxBytes is the error when the input exceeds the limit set via WithMaxBytes
+var ErrMaxBytes = errors.New("maximum number of bytes reached")
+
+// ErrMaxLines is the error when the input exceeds the limit set via WithMaxLines
+var ErrMaxLines = errors.New("maximum number of lines reached")
+
+// ErrNotReplaceable is returned by ReplaceCurrent, if the parent can't get another child
+var ErrNotReplaceable = errors.New("node can't be replaced: parent is not a ChildrenProvider and ChildSetter")
+
+// ErrMaxRunes is the error when more runes are read than allowed via WithMaxRunes
+var ErrMaxRunes = errors.New("maximum number of runes reached")
+
+// ErrMaxDepth is the error when the astQueue would get deeper than allowed via WithMaxDepth
+var ErrMaxDepth = errors.New("maximum depth reached")
+
+// ErrNotAtRoot is returned by SetRoot, if nodes have been added to the astQueue
+var ErrNotAtRoot = errors.New("root can't be replaced: astQueue contains more than the root")
+
 type ASTNode interface {
 	AddChild(ASTNode)
 }
 
+// Positioned is implemented by nodes that want to know where they were added
+type Positioned interface {
+	SetPos(Position)
+}
+
+// ChildRemover is implemented by nodes whose children can be removed again,
+// so that Rollback can undo AddNode
+type ChildRemover interface {
+	RemoveChild(ASTNode)
+}
+
+// PositionedNode is implemented by nodes that want to know the span of the input
+// they cover: the positions where they were added and popped
+type PositionedNode interface {
+	SetSpan(start, end Position)
+}
+
+// Spanned is implemented by nodes that want to know the byte offsets
+// of the input they cover, like PositionedNode
+type Spanned interface {
+	SetSpan(start, end int)
+}
+
 type Parser struct {
-	astQueue    []ASTNode
-	input       string // the string being scanned
-	start       int    // start position of this item
-	pos         int    // current position in the input
-	width       int    // width of the last rune read
-	line        int
-	linepos     int
-	linePrev    int
-	lineposPrev int
-	err         error
+	astQueue      []ASTNode
+	nodeStarts    []Position // start positions of the nodes in the astQueue
+	input         string     // the string being scanned
+	start         int        // start position of this item
+	startLine     int        // line of the start position
+	startPos      int        // linepos of the start position
+	pos           int        // current position in the input
+	width         int        // width of the last rune read
+	pushback      []rune     // runes pushed back via Unget, the last one is read first
+	ungot         bool       // whether the last rune read came from pushback
+	reads         []virtualRead
+	line          int
+	linepos       int
+	baseLine      int // line of the start of the input
+	baseCol       int // linepos of the start of the input
+	firstLine     int // line of the start of the whole input, see WithBase
+	linePrev      int
+	lineposPrev   int
+	err           error
+	stats         Stats
+	states        []string           // names of the running named states
+	names         map[uintptr]string // names of the states of the grammar
+	loopGuard     int
+	guardKey      uintptr // see stateKey
+	nameSlot      *string // where the NameState closure run by call puts its name
+	lastName      string  // the name of the state run last by call, if known
+	guardPos      int
+	guardCount    int
+	maxBytes      int
+	maxLines      int
+	maxRunes      int
+	maxDepth      int
+	contextWindow int             // runes of the error context before and after the position
+	ctx           context.Context // the context of RunContext
+	rejectInvalid bool
+	identRune     func(rune) bool
+	fold          bool
+	filter        func(rune) rune
+	onEmit        func(Token)
+	recording     bool
+	tokens        []Token
+	values        map[string]interface{}
+	src           io.Reader // the unread input of NewReader
+	srcErr        error
+	streaming     bool
+	discarded     int    // number of bytes before the kept input
+	raw           []byte // the kept input of NewReader, aliased by input
+	added         []addition
+	tokenCh       chan Token // the channel of RunTokens
+	errs          []error    // errors collected by ErrorfContinue and Recover
+	trace         io.Writer
+	incremental   bool  // input is given via Feed
+	closed        bool  // no more input follows
+	resume        State // the state to run again by Resume
+	atEOF         bool  // the end of the input has been hit
+	skipper       State // see SetSkipper
+	skipping      bool  // the skipper is running
+	skipped       int   // 1 + the absolute offset where the skipper ran last
+
+	sources     []sourceMapping // sorted by offset
+	sourceStack []Position      // the positions where PushSource was called
+
+	strict   bool  // see WithStrict
+	backedUp bool  // Backup was called without Next afterwards
+	misused  error // the first misuse in strict mode
+}
+
+// addition is a child added to a ChildRemover or
+// a child that replaced old via ReplaceCurrent
+type addition struct {
+	parent ASTNode
+	child  ASTNode
+	old    ASTNode
+}
+
+// undo removes the child from the parent or puts old back in its place
+func (a addition) undo() {
+	if a.old != nil {
+		replaceChild(a.parent, a.child, a.old)
+		return
+	}
+	a.parent.(ChildRemover).RemoveChild(a.child)
+}
+
+// Stats are counters collected while parsing
+type Stats struct {
+	Runes    int // number of runes read by Next
+	Backups  int // number of calls to Backup
+	Emits    int // number of calls to Emit
+	MaxDepth int // maximal length of the astQueue
+}
+
+// Stats returns a snapshot of the counters
+func (p *Parser) Stats() Stats {
+	return p.stats
+}
+
+// SetValue stores val under key, so that states can share grammar specific data
+func (p *Parser) SetValue(key string, val interface{}) {
+	if p.values == nil {
+		p.values = map[string]interface{}{}
+	}
+	p.values[key] = val
+}
+
+// Value returns the value stored under key or nil
+func (p *Parser) Value(key string) interface{} {
+	return p.values[key]
 }
 
 // QueueLen returns the length of the astQueue
@@ -40,52 +184,319 @@ func (p *Parser) QueueLen() int {
 	return len(p.astQueue)
 }
 
-func New(input string, root ASTNode) *Parser {
-	return &Parser{
-		astQueue: []ASTNode{root},
-		input:    input,
+func New(input string, root ASTNode, options ...Option) *Parser {
+	p := &Parser{
+		astQueue:      []ASTNode{root},
+		nodeStarts:    []Position{{}},
+		input:         input,
+		stats:         Stats{MaxDepth: 1},
+		identRune:     isIdentRune,
+		contextWindow: 5,
 	}
+	for _, o := range options {
+		o(p)
+	}
+	return p
+}
+
+// Input returns the input being parsed
+// for a parser of NewReader, it is the input read so far that is still kept
+func (p *Parser) Input() string {
+	return p.input
 }
 
 func (p *Parser) Root() ASTNode {
 	return p.astQueue[0]
 }
 
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// SetRoot replaces the root node
+// it fails with ErrNotAtRoot, if nodes have been added to the astQueue
+func (p *Parser) SetRoot(newRoot ASTNode) error {
+	if len(p.astQueue) > 1 {
+		return ErrNotAtRoot
+	}
+	p.astQueue[0] = newRoot
+	return nil
+}
+
 func (p *Parser) Last() ASTNode {
 	return p.astQueue[len(p.astQueue)-1]
 }
 
+// AddNode adds n as child of the last node and pushes it onto the astQueue
+// if n is Positioned, it gets the current position
+// adding nil sets an error instead
 func (p *Parser) AddNode(n ASTNode) {
+	if n == nil {
+		p.Errorf("can't add nil node")
+		return
+	}
+	if p.maxDepth > 0 && len(p.astQueue) >= p.maxDepth {
+		p.Errorf("%w: %d", ErrMaxDepth, p.maxDepth)
+		return
+	}
+	if pn, ok := n.(Positioned); ok {
+		pn.SetPos(p.position())
+	}
 	p.Last().AddChild(n)
+	if _, ok := p.Last().(ChildRemover); ok {
+		p.added = append(p.added, addition{parent: p.Last(), child: n})
+	}
 	p.astQueue = append(p.astQueue, n)
+	p.nodeStarts = append(p.nodeStarts, p.position())
+	if len(p.astQueue) > p.stats.MaxDepth {
+		p.stats.MaxDepth = len(p.astQueue)
+	}
 }
 
-func (p *Parser) PopNode() {
+// PopNode returns to the parent of the last node
+// if the last node is a PositionedNode or Spanned, it gets its span
+// it returns false, if the last node is the root, which is not popped
+func (p *Parser) PopNode() bool {
 	if len(p.astQueue) < 2 {
-		return
+		return false
 	}
-	p.astQueue = p.astQueue[:len(p.astQueue)-1]
+	p.pop()
+	return true
+}
+
+// PopNodeN pops the last n nodes like PopNode
+// it returns false without popping anything, if it would pop the root
+func (p *Parser) PopNodeN(n int) bool {
+	if n < 0 || n >= len(p.astQueue) {
+		return false
+	}
+	p.popTo(len(p.astQueue) - n)
+	return true
+}
+
+// CurrentNode returns the last node, to which AddNode adds children
+func (p *Parser) CurrentNode() ASTNode {
+	return p.Last()
+}
+
+// Depth returns the number of nodes in the astQueue above the root
+func (p *Parser) Depth() int {
+	return len(p.astQueue) - 1
+}
+
+// ReplaceCurrent replaces the last node by n, also as child of its parent,
+// e.g. to wrap it into a new node. n keeps the start position of the last node.
+// It fails with ErrNotReplaceable, if the parent is not a ChildrenProvider and
+// a ChildSetter. Replacing the root is like SetRoot.
+func (p *Parser) ReplaceCurrent(n ASTNode) error {
+	last := len(p.astQueue) - 1
+	if last > 0 {
+		parent := p.astQueue[last-1]
+		if !replaceChild(parent, p.astQueue[last], n) {
+			return ErrNotReplaceable
+		}
+		// Rollback puts the last node back
+		p.added = append(p.added, addition{parent: parent, child: n, old: p.astQueue[last]})
+	}
+	p.astQueue[last] = n
+	return nil
+}
+
+// replaceChild replaces the last occurrence of old in the children of parent by n
+// it returns false, if parent is not a ChildrenProvider and a ChildSetter
+func replaceChild(parent, old, n ASTNode) bool {
+	cp, isProvider := parent.(ChildrenProvider)
+	cs, isSetter := parent.(ChildSetter)
+	if !isProvider || !isSetter {
+		return false
+	}
+	children := append([]ASTNode(nil), cp.Children()...)
+	for i := len(children) - 1; i >= 0; i-- {
+		if children[i] == old {
+			children[i] = n
+			break
+		}
+	}
+	cs.SetChildren(children)
+	return true
+}
+
+// pop pops the last node, also the root
+func (p *Parser) pop() {
+	last := len(p.astQueue) - 1
+	switch n := p.astQueue[last].(type) {
+	case PositionedNode:
+		n.SetSpan(p.nodeStarts[last], p.position())
+	case Spanned:
+		n.SetSpan(p.nodeStarts[last].Offset, p.discarded+p.pos)
+	}
+	p.astQueue = p.astQueue[:last]
+	p.nodeStarts = p.nodeStarts[:last]
+}
+
+// StartNode is AddNode, the current position is the start of the node,
+// which is passed to a PositionedNode or Spanned by EndNode
+func (p *Parser) StartNode(n ASTNode) {
+	p.AddNode(n)
+}
+
+// EndNode is PopNode, the counterpart of StartNode
+func (p *Parser) EndNode() bool {
+	return p.PopNode()
+}
+
+// WithNode adds n, calls fn to parse its children and returns to the previous
+// node afterwards, even if fn panics or sets an error
+func (p *Parser) WithNode(n ASTNode, fn func()) {
+	defer p.popTo(len(p.astQueue))
+	p.AddNode(n)
+	if n != nil {
+		fn()
+	}
+}
+
+// popTo pops nodes until the astQueue has the given length
+func (p *Parser) popTo(depth int) {
+	for depth < len(p.astQueue) {
+		p.pop()
+	}
+}
+
+// CurrentNodeText returns the input from the position where the last node
+// was added up to the current position
+// (for a parser of NewReader only the part that is still kept)
+// it is empty, if Backup stepped behind the start of the node
+func (p *Parser) CurrentNodeText() string {
+	start := min(max(p.nodeStarts[len(p.nodeStarts)-1].Offset-p.discarded, 0), p.pos)
+	return p.input[start:p.pos]
 }
 
 func (p *Parser) HasError() bool {
 	return p.err != nil
 }
 
+// IsEOF reports whether Next has hit the end of the input,
+// independent of the error that is set
 func (p *Parser) IsEOF() bool {
-	return p.err == ErrEOF
+	return p.atEOF
 }
 
 func (p *Parser) Next() (rune_ rune) {
+	if p.plain() && p.pos < len(p.input) {
+		if c := p.input[p.pos]; c < utf8.RuneSelf && c != '\n' && c != '\r' {
+			// the fast path of read for an ASCII rune other than a line break
+			p.ungot, p.backedUp = false, false
+			p.width = 1
+			p.pos++
+			p.stats.Runes++
+			p.linePrev, p.lineposPrev = p.line, p.linepos
+			p.linepos++
+			return rune(c)
+		}
+	}
+	if n := len(p.pushback); n > 0 {
+		rune_ = p.pushback[n-1]
+		p.pushback = p.pushback[:n-1]
+		p.width = 0
+		p.ungot = true
+		p.reads = append(p.reads, virtualRead{pos: p.pos, r: rune_})
+		p.stats.Runes++
+		p.backedUp = false
+		return
+	}
+	p.skip()
+	p.ungot = false
+	rune_ = p.read()
+	// the skipper may have ended with a Backup
+	p.backedUp = false
+	if p.filter != nil && p.width > 0 {
+		rune_ = p.filter(rune_)
+	}
+	if p.width == 0 {
+		if n := len(p.reads); n > 0 && p.reads[n-1].eof && p.reads[n-1].pos == p.pos {
+			p.reads[n-1].count++
+		} else {
+			p.reads = append(p.reads, virtualRead{pos: p.pos, eof: true, count: 1})
+		}
+	}
+	return
+}
+
+// plain reports whether the parser reads a string as it is,
+// without the options, skipper, pushback or end of the input read needs to care for
+func (p *Parser) plain() bool {
+	return p.src == nil && p.skipper == nil && p.filter == nil && len(p.pushback) == 0 && len(p.reads) == 0 &&
+		p.maxBytes == 0 && p.maxLines == 0 && p.maxRunes == 0 && p.ctx == nil && !p.rejectInvalid && !p.incremental
+}
+
+// virtualRead is a call of Next that did not consume input,
+// i.e. that returned an ungot rune or hit the end of the input
+type virtualRead struct {
+	pos   int
+	r     rune // the ungot rune
+	eof   bool
+	count int // number of consecutive calls that hit the end
+}
+
+// read reads the next rune from the input, ignoring the pushback
+func (p *Parser) read() (rune_ rune) {
+	// one more byte to see whether a \r is followed by \n
+	p.fill(utf8.UTFMax + 1)
 	if p.pos >= len(p.input) {
 		p.width = 0
-		p.err = ErrEOF
+		switch {
+		case p.open():
+			p.setErr(ErrIncomplete)
+		case p.srcErr != nil:
+			p.atEOF = true
+			p.setErr(p.srcErr)
+		default:
+			p.atEOF = true
+			p.setErr(ErrEOF)
+		}
+		return EOF
+	}
+	if p.maxBytes > 0 && p.discarded+p.pos >= p.maxBytes {
+		p.width = 0
+		p.setErr(fmt.Errorf("%w: %d bytes", ErrMaxBytes, p.maxBytes))
 		return EOF
 	}
+	if p.maxLines > 0 && p.line-p.firstLine >= p.maxLines {
+		p.width = 0
+		p.setErr(fmt.Errorf("%w: %d lines", ErrMaxLines, p.maxLines))
+		return EOF
+	}
+	if p.maxRunes > 0 && p.stats.Runes >= p.maxRunes {
+		p.width = 0
+		p.setErr(fmt.Errorf("%w: %d runes", ErrMaxRunes, p.maxRunes))
+		return EOF
+	}
+	if p.ctx != nil && p.stats.Runes%ctxCheckRunes == 0 {
+		if err := p.ctx.Err(); err != nil {
+			p.width = 0
+			p.setErr(err)
+			return EOF
+		}
+	}
+	p.dropStaleEOF()
 	rune_, p.width = utf8.DecodeRuneInString(p.input[p.pos:])
+	if p.rejectInvalid {
+		if cp, invalid := p.invalidCodepoint(rune_); invalid {
+			p.width = 0
+			p.Errorf("invalid code point U+%04X", cp)
+			return EOF
+		}
+	}
+	if p.pos > 0 && p.input[p.pos-1] == '\r' && rune_ != '\n' && p.linepos > 0 {
+		// the \r was undecided at the end of the input, before Feed added more
+		p.line++
+		p.linepos = 0
+	}
 	p.pos += p.width
+	p.stats.Runes++
 	p.linePrev = p.line
 	p.lineposPrev = p.linepos
-	if rune_ == '\n' {
+	if (rune_ == '\n' || rune_ == '\r') && p.isLineBreak(p.pos-1) {
 		p.line++
 		p.linepos = 0
 	} else {
@@ -95,86 +506,767 @@ func (p *Parser) Next() (rune_ rune) {
 	return
 }
 
+// dropStaleEOF drops a former end of the input, that is stale, once we are reading
+func (p *Parser) dropStaleEOF() {
+	for n := len(p.reads); n > 0 && p.reads[n-1].eof; n-- {
+		p.reads = p.reads[:n-1]
+	}
+}
+
+// invalidCodepoint checks whether r, just decoded at the current position,
+// is a surrogate or a noncharacter and returns its code point
+func (p *Parser) invalidCodepoint(r rune) (rune, bool) {
+	if r == utf8.RuneError && p.width == 1 {
+		// surrogates are not valid UTF-8 and decode to RuneError
+		s := p.input[p.pos:]
+		if len(s) >= 3 && s[0] == 0xED && s[1] >= 0xA0 && s[1] <= 0xBF && s[2]&0xC0 == 0x80 {
+			return 0xD000 | rune(s[1]&0x3F)<<6 | rune(s[2]&0x3F), true
+		}
+		return r, false
+	}
+	return r, r >= 0xFDD0 && r <= 0xFDEF || r&0xFFFE == 0xFFFE
+}
+
+// hitEnd reports whether the last call of Next hit the end of the input
+func (p *Parser) hitEnd() bool {
+	return p.width == 0 && !p.ungot
+}
+
+// PrevPosition returns the line and column (both starting with 1)
+// as they were before the last call of Next that consumed a rune
+// and has not been undone by Backup. Peek does not change them.
+func (p *Parser) PrevPosition() (line, col int) {
+	return p.linePrev + 1, p.lineposPrev + 1
+}
+
+// Runes returns an iterator over the remaining runes and their byte offsets
+// each yielded rune is consumed, so that after breaking out of the loop
+// the parser is positioned behind the last yielded rune
+func (p *Parser) Runes() iter.Seq2[int, rune] {
+	return func(yield func(int, rune) bool) {
+		for {
+			offset := p.discarded + p.pos
+			r := p.Next()
+			if p.hitEnd() || !yield(offset, r) {
+				return
+			}
+		}
+	}
+}
+
 // emit passes an item back to the client
+// it returns exactly the input between the last Emit, Ignore or Rollback
+// and the current position. If Backup stepped behind that point,
+// the input from there on is returned.
 func (p *Parser) Emit() string {
-	s := p.input[p.start:p.pos]
-	p.start = p.pos
+	return p.emit(0).Value
+}
+
+// EmitUpTo emits the pending input up to the byte offset, which becomes
+// the start of the next emit. The offset must be at a rune boundary between
+// the start of the pending input and the current position, otherwise an error is set.
+func (p *Parser) EmitUpTo(offset int) string {
+	offset -= p.discarded
+	if offset < p.start || offset > p.pos || offset < len(p.input) && !utf8.RuneStart(p.input[offset]) {
+		p.Errorf("can't emit up to offset %d, it must be at a rune boundary between %d and %d", p.discarded+offset, p.discarded+p.start, p.discarded+p.pos)
+		return ""
+	}
+	return p.emitTo(0, offset).Value
+}
+
+// EmitWithRuneCount is like Emit but also returns the number of runes of the emitted text
+func (p *Parser) EmitWithRuneCount() (string, int) {
+	s := p.Emit()
+	return s, utf8.RuneCountInString(s)
+}
+
+// EmitFiltered is like Emit but returns the text as seen through the filter
+// set via WithRuneFilter
+func (p *Parser) EmitFiltered() string {
+	s := p.Emit()
+	if p.filter == nil {
+		return s
+	}
+	return strings.Map(p.filter, s)
+}
+
+// EmitNormalized is like Emit but returns the emitted text with
+// \r\n and single \r replaced by \n
+func (p *Parser) EmitNormalized() string {
+	return crlf.Replace(p.Emit())
+}
+
+var crlf = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// EmitThenSkip emits the pending span and ignores a following run of the runes in ws
+func (p *Parser) EmitThenSkip(ws string) string {
+	s := p.Emit()
+	p.AcceptRun(ws)
+	p.Ignore()
 	return s
 }
 
+// EmitNonEmpty is like Emit but returns false, if nothing has been consumed since the last emit
+func (p *Parser) EmitNonEmpty() (string, bool) {
+	if p.pos == p.start {
+		return "", false
+	}
+	return p.Emit(), true
+}
+
+// EmitMarker returns an empty token positioned at the current position
+// neither the position nor the start of the next emit are changed
+func (p *Parser) EmitMarker() Token {
+	pos := p.position()
+	return Token{
+		StartOffset: pos.Offset,
+		EndOffset:   pos.Offset,
+		Line:        pos.Line,
+		Column:      pos.Column,
+		File:        pos.File,
+	}
+}
+
 func (p *Parser) Ignore() {
+	if n := len(p.reads); p.strict && n > 0 && p.reads[n-1].eof && p.reads[n-1].pos == p.pos {
+		p.misuse("Ignore after Next returned EOF")
+	}
 	p.start = p.pos
+	p.startLine = p.line
+	p.startPos = p.linepos
+	// virtual reads before the start can't be undone anymore
+	i := 0
+	for i < len(p.reads) && p.reads[i].pos < p.start {
+		i++
+	}
+	p.reads = append(p.reads[:0], p.reads[i:]...)
+	p.compact()
 }
 
-// backup steps back one rune
-// can be called only once per call of next
+// backup steps back one rune, undoing the last call of Next that is not undone yet
+// it can be called repeatedly to step back several runes
+// undoing a Next that returned EOF does nothing
+// undoing a Next that returned an ungot rune pushes the rune back again
 func (p *Parser) Backup() {
-	rune_, _ := utf8.DecodeRuneInString(p.input[p.pos:])
-	if rune_ == '\n' {
+	if p.backedUp {
+		p.misuse("Backup without Next since the last Backup")
+	}
+	start := p.start
+	p.backup()
+	if p.start < start {
+		p.misuse("Backup behind the start of the pending emit")
+	}
+	p.backedUp = true
+}
+
+// backup is Backup without the checks of WithStrict, used by Peek, the Accept functions etc.
+func (p *Parser) backup() {
+	if n := len(p.reads); n > 0 && p.reads[n-1].pos == p.pos {
+		v := &p.reads[n-1]
+		if v.eof {
+			v.count--
+			if v.count == 0 {
+				p.reads = p.reads[:n-1]
+			}
+			return
+		}
+		p.reads = p.reads[:n-1]
+		p.stats.Backups++
+		p.Unget(v.r)
+		return
+	}
+	if p.pos == 0 {
+		return
+	}
+	p.stats.Backups++
+	r, width := utf8.DecodeLastRuneInString(p.input[:p.pos])
+	p.pos -= width
+	if (r == '\n' || r == '\r') && p.isLineBreak(p.pos) {
 		p.line--
+		p.linepos = p.column(p.pos)
+	} else {
+		p.linepos--
+	}
+	// the rune will be read again, so it belongs to the next emit
+	if p.pos < p.start {
+		p.start, p.startLine, p.startPos = p.pos, p.line, p.linepos
 	}
-	p.linepos = p.lineposPrev
-	p.pos -= p.width
+	p.setPrev()
 }
 
+// setPrev sets the previous position to the start of the rune before the current position
+func (p *Parser) setPrev() {
+	p.linePrev, p.lineposPrev = p.line, p.linepos
+	if p.pos == 0 {
+		return
+	}
+	r, width := utf8.DecodeLastRuneInString(p.input[:p.pos])
+	if (r == '\n' || r == '\r') && p.isLineBreak(p.pos-width) {
+		p.linePrev, p.lineposPrev = p.line-1, p.column(p.pos-width)
+	} else {
+		p.lineposPrev--
+	}
+}
+
+// Unget pushes r back, so that it is returned by the next call of Next.
+// The pushed back runes are read in reverse order of their Unget calls.
+// They are not part of the input: reading them does not change the
+// position, line or column and they are never part of an emitted text.
+func (p *Parser) Unget(r rune) {
+	p.pushback = append(p.pushback, r)
+}
+
+// Peek returns the next rune without consuming it
+// at the end of the input, it returns EOF and sets the error of the end (usually ErrEOF)
 func (p *Parser) Peek() rune {
+	p.skip()
+	linePrev, lineposPrev, stats := p.linePrev, p.lineposPrev, p.stats
 	r := p.Next()
-	p.Backup()
+	p.backup()
+	p.linePrev, p.lineposPrev, p.stats = linePrev, lineposPrev, stats
+	return r
+}
+
+// peek returns the next rune without any side effects
+// it returns false at the end of the input
+func (p *Parser) peek() (rune, bool) {
+	if n := len(p.pushback); n > 0 {
+		return p.pushback[n-1], true
+	}
+	p.fill(utf8.UTFMax)
+	if p.pos >= len(p.input) {
+		return EOF, false
+	}
+	r, _ := utf8.DecodeRuneInString(p.input[p.pos:])
+	if p.filter != nil {
+		r = p.filter(r)
+	}
+	return r, true
+}
+
+// PeekN returns the next n runes without consuming them, as Next would return them
+// near the end of the input, fewer runes are returned, for n <= 0 none
+func (p *Parser) PeekN(n int) []rune {
+	if n <= 0 {
+		return nil
+	}
+	p.skip()
+	runes := make([]rune, 0, n)
+	for i := len(p.pushback) - 1; i >= 0 && len(runes) < n; i-- {
+		runes = append(runes, p.pushback[i])
+	}
+	for offset := p.pos; len(runes) < n; {
+		p.fill(offset - p.pos + utf8.UTFMax)
+		if offset >= len(p.input) || p.maxBytes > 0 && p.discarded+offset >= p.maxBytes {
+			break
+		}
+		r, width := utf8.DecodeRuneInString(p.input[offset:])
+		if p.filter != nil {
+			r = p.filter(r)
+		}
+		runes = append(runes, r)
+		offset += width
+	}
+	return runes
+}
+
+// PeekString is like PeekN but returns the runes as string
+func (p *Parser) PeekString(n int) string {
+	return string(p.PeekN(n))
+}
+
+// AtWordBoundary reports whether exactly one of the runes before and after
+// the current position is a word rune according to isWordRune
+// the start and the end of the input count as non-word runes
+func (p *Parser) AtWordBoundary(isWordRune func(rune) bool) bool {
+	before := !p.AtStart() && isWordRune(p.PeekBack())
+	next, ok := p.peek()
+	after := ok && isWordRune(next)
+	return before != after
+}
+
+// PeekBack returns the rune before the current position without changing anything
+// at the start of the input it returns EOF
+func (p *Parser) PeekBack() rune {
+	if p.pos == 0 {
+		return EOF
+	}
+	r, _ := utf8.DecodeLastRuneInString(p.input[:p.pos])
+	if p.filter != nil {
+		r = p.filter(r)
+	}
 	return r
 }
 
 func (p *Parser) Accept(valid string) bool {
-	if strings.IndexRune(valid, p.Next()) >= 0 {
+	if p.inSet(valid, p.Next()) {
+		return true
+	}
+	p.backup()
+	return false
+}
+
+// AcceptOptional consumes the next rune, if it is one of valid
+func (p *Parser) AcceptOptional(valid string) {
+	p.Accept(valid)
+}
+
+// AcceptOptionalFunc consumes the next rune, if it satisfies pred
+func (p *Parser) AcceptOptionalFunc(pred func(rune) bool) {
+	p.AcceptFunc(pred)
+}
+
+// AcceptFunc consumes the next rune, if it satisfies pred
+func (p *Parser) AcceptFunc(pred func(rune) bool) bool {
+	r := p.Next()
+	if p.hitEnd() || !pred(r) {
+		p.backup()
+		return false
+	}
+	return true
+}
+
+// AcceptRunFunc accepts a run of runes satisfying pred and returns its length
+func (p *Parser) AcceptRunFunc(pred func(rune) bool) int {
+	return p.AcceptRunOf(pred)
+}
+
+// AcceptNewline consumes a line break: \n, \r\n or \r
+func (p *Parser) AcceptNewline() bool {
+	return p.acceptLiteral("\r\n") || p.Accept("\n\r")
+}
+
+// AcceptAny consumes and returns the next rune
+// at the end of the input it returns false without setting ErrEOF
+func (p *Parser) AcceptAny() (rune, bool) {
+	p.skip()
+	if _, ok := p.peek(); !ok {
+		return 0, false
+	}
+	r := p.Next()
+	if p.hitEnd() {
+		return 0, false
+	}
+	return r, true
+}
+
+// AcceptRune consumes the next rune, if it is r
+func (p *Parser) AcceptRune(r rune) bool {
+	if next := p.Next(); !p.hitEnd() && (next == r || p.fold && equalFold(next, r)) {
 		return true
 	}
-	p.Backup()
+	p.backup()
 	return false
 }
 
+// ExpectRune is like AcceptRune but sets an error if the next rune is not r
+// what describes the expected rune in the error message
+func (p *Parser) ExpectRune(r rune, what string) bool {
+	if p.AcceptRune(r) {
+		return true
+	}
+	p.Errorf("expected %s, got %q", what, p.Peek())
+	return false
+}
+
+// ExpectFunc consumes and returns the next rune, if it satisfies pred
+// otherwise it sets an error, where what describes the expected rune
+func (p *Parser) ExpectFunc(pred func(rune) bool, what string) (rune, bool) {
+	r := p.Next()
+	if !p.hitEnd() && pred(r) {
+		return r, true
+	}
+	p.backup()
+	p.Errorf("expected %s, got %q", what, r)
+	return r, false
+}
+
 func (p *Parser) AcceptRun(valid string) {
-	for strings.IndexRune(valid, p.Next()) >= 0 {
+	for p.inSet(valid, p.Next()) {
 	}
-	p.Backup()
+	p.backup()
 }
 
-// runs forward until one of the stopper
-func (p *Parser) ForwardUntil(stopper string) {
-	for strings.IndexRune(stopper, p.Next()) == -1 {
+// AcceptRepeated accepts a run of the rune r and returns its length
+func (p *Parser) AcceptRepeated(r rune) (count int) {
+	for p.AcceptRune(r) {
+		count++
 	}
-	p.Backup()
+	return
 }
 
+// AcceptRunOf accepts a run of runes satisfying any of the classes
+// and returns the number of accepted runes
+func (p *Parser) AcceptRunOf(classes ...func(rune) bool) (count int) {
+	for {
+		r := p.Next()
+		if p.hitEnd() || !anyOf(classes, r) {
+			p.backup()
+			return
+		}
+		count++
+	}
+}
+
+// AcceptRunStateful accepts runes as long as step, which gets each rune and
+// its index within the run, returns true and returns the accepted run
+func (p *Parser) AcceptRunStateful(step func(r rune, index int) bool) string {
+	p.skip()
+	begin := p.pos
+	for i := 0; ; i++ {
+		r := p.Next()
+		if p.hitEnd() || !step(r, i) {
+			p.backup()
+			return p.input[begin:p.pos]
+		}
+	}
+}
+
+func anyOf(classes []func(rune) bool, r rune) bool {
+	for _, class := range classes {
+		if class(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptRunEOF is like AcceptRun but returns the number of accepted runes
+// and whether the run was stopped by the end of the input
+func (p *Parser) AcceptRunEOF(valid string) (count int, hitEOF bool) {
+	for {
+		r := p.Next()
+		if p.hitEnd() {
+			hitEOF = true
+			break
+		}
+		if !p.inSet(valid, r) {
+			break
+		}
+		count++
+	}
+	p.backup()
+	return
+}
+
+// AcceptString consumes s, if the input continues with it
+// otherwise, or if s is empty, nothing is consumed. See WithCaseInsensitive.
+func (p *Parser) AcceptString(s string) bool {
+	return p.acceptLiteral(s)
+}
+
+// AcceptStringFold is like AcceptString but always ignores the case
+func (p *Parser) AcceptStringFold(s string) bool {
+	fold := p.fold
+	p.fold = true
+	ok := p.acceptLiteral(s)
+	p.fold = fold
+	return ok
+}
+
+// AcceptKeyword consumes the longest of the keywords at the current position
+// and returns its index. A keyword ending with an identifier rune (see WithIdentRune)
+// must not be followed by another identifier rune, so that e.g. "for" is not
+// accepted at the start of "format".
+func (p *Parser) AcceptKeyword(keywords []string) (index int, ok bool) {
+	index = -1
+	matched := 0
+	for i, kw := range keywords {
+		if kw == "" || (index >= 0 && len(kw) <= len(keywords[index])) {
+			continue
+		}
+		n := p.matchLiteral(kw)
+		if n < 0 {
+			continue
+		}
+		last, _ := utf8.DecodeLastRuneInString(kw)
+		next, width := utf8.DecodeRuneInString(p.input[p.pos+n:])
+		if width > 0 && p.identRune(last) && p.identRune(next) {
+			continue
+		}
+		index, matched = i, n
+	}
+	if index < 0 {
+		return -1, false
+	}
+	p.advance(matched)
+	return index, true
+}
+
+// AcceptRegexp consumes the text matched by re at the current position
+// re should be anchored with ^, since otherwise it is searched in the whole remaining input
+// and the match does not count unless it starts at the current position
+func (p *Parser) AcceptRegexp(re *regexp.Regexp) (string, bool) {
+	n := p.matchRegexp(re)
+	if n < 0 {
+		return "", false
+	}
+	begin := p.pos
+	p.advance(n)
+	return p.input[begin:p.pos], true
+}
+
+// EmitRegexp is like AcceptRegexp but emits the pending input up to the end of the match
+func (p *Parser) EmitRegexp(re *regexp.Regexp) (string, bool) {
+	if _, ok := p.AcceptRegexp(re); !ok {
+		return "", false
+	}
+	return p.Emit(), true
+}
+
+// matchRegexp returns the length of the match of re at the current position
+// or -1, if there is none
+func (p *Parser) matchRegexp(re *regexp.Regexp) int {
+	p.skip()
+	p.fillAll()
+	loc := re.FindStringIndex(p.input[p.pos:])
+	if loc == nil || loc[0] != 0 {
+		return -1
+	}
+	return loc[1]
+}
+
+// advance consumes the next n bytes while tracking lines and columns
+func (p *Parser) advance(n int) {
+	p.backedUp = false
+	end := p.pos + n
+	for p.pos < end {
+		p.ungot = false
+		p.read()
+		if p.width == 0 {
+			return
+		}
+	}
+}
+
+// AcceptRunBounded accepts a run of the runes in valid that must be followed
+// by a rune satisfying mustFollow (which gets EOF at the end of the input).
+// It returns the accepted run. If mustFollow is not satisfied, it steps back
+// to where it started and returns false.
+func (p *Parser) AcceptRunBounded(valid string, mustFollow func(rune) bool) (string, bool) {
+	p.skip()
+	cp := p.Checkpoint()
+	begin := p.pos
+	p.AcceptRun(valid)
+	if !mustFollow(p.Peek()) {
+		p.Rollback(cp)
+		return "", false
+	}
+	return p.input[begin:p.pos], true
+}
+
+// runs forward until one of the stopper or the end of the input
+// it returns false, if the end of the input was reached, without setting ErrEOF
+func (p *Parser) ForwardUntil(stopper string) (found bool) {
+	err := p.err
+	for r := p.Next(); !p.hitEnd() && !p.inSet(stopper, r); r = p.Next() {
+	}
+	found = !p.hitEnd()
+	p.backup()
+	if p.err == ErrEOF {
+		p.err = err
+	}
+	return
+}
+
+// ForwardUntilString is like ForwardUntil but stops before delim, see WithCaseInsensitive
+func (p *Parser) ForwardUntilString(delim string) bool {
+	err := p.err
+	for p.matchLiteral(delim) < 0 {
+		p.Next()
+		if p.hitEnd() {
+			p.backup()
+			if p.err == ErrEOF {
+				p.err = err
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// ForwardThrough runs forward until one of the stopper and consumes it
+// it returns the matched stopper and false, if the end of the input was reached before
+func (p *Parser) ForwardThrough(stopper string) (rune, bool) {
+	for {
+		r := p.Next()
+		if p.hitEnd() {
+			return EOF, false
+		}
+		if p.inSet(stopper, r) {
+			return r, true
+		}
+	}
+}
+
+// the first error wins, see setErr
 func (p *Parser) Errorf(format string, args ...interface{}) {
-	start := p.pos - 5
-	if start < 0 {
-		start = 0
+	if p.failed() || p.err == ErrIncomplete {
+		return
+	}
+	p.setErr(p.errorf(format, args...))
+}
+
+// setErr sets err, unless an error has been set before. Only ErrEOF can be
+// replaced, since it is not an error of the input. ErrIncomplete is kept,
+// since later errors are likely caused by the missing input.
+func (p *Parser) setErr(err error) {
+	if p.err == nil || p.err == ErrEOF {
+		p.err = err
+	}
+}
+
+// ErrorfContinue is like Errorf but only collects the error, so that parsing goes on
+// see Errors
+func (p *Parser) ErrorfContinue(format string, args ...interface{}) {
+	p.errs = append(p.errs, p.errorf(format, args...))
+}
+
+func (p *Parser) errorf(format string, args ...interface{}) error {
+	// the context does not reach beyond the current line
+	start, end := p.lineStart(p.pos), p.lineEnd(p.pos)
+	if p.contextWindow > 0 {
+		start, end = p.runesBack(p.pos, start, p.contextWindow), p.runesForward(p.pos, end, p.contextWindow)
+	}
+	text := p.input[start:end] + "\n" + p.marker(start, p.pos, 1)
+	return p.newError(p.position(), fmt.Errorf(format, args...), text)
+}
+
+// runesBack returns the offset n runes before offset, but not before limit
+func (p *Parser) runesBack(offset, limit, n int) int {
+	for ; n > 0 && offset > limit; n-- {
+		_, width := utf8.DecodeLastRuneInString(p.input[limit:offset])
+		offset -= width
+	}
+	return offset
+}
+
+// runesForward returns the offset n runes behind offset, but not behind limit
+func (p *Parser) runesForward(offset, limit, n int) int {
+	for ; n > 0 && offset < limit; n-- {
+		_, width := utf8.DecodeRuneInString(p.input[offset:limit])
+		offset += width
+	}
+	return offset
+}
+
+// marker returns a line with n carets under the rune at offset in a context starting at from
+func (p *Parser) marker(from, offset, n int) string {
+	var marker strings.Builder
+	for _, r := range p.input[from:offset] {
+		if r == '\t' {
+			marker.WriteRune('\t')
+		} else {
+			marker.WriteRune(' ')
+		}
+	}
+	marker.WriteString(strings.Repeat("^", max(n, 1)))
+	return marker.String()
+}
+
+// Recover collects the current error (see Errors) and clears it, then skips
+// the input up to one of the runes in syncSet, so that parsing can go on there.
+// It returns false, if the end of the input is reached before.
+// ErrEOF and ErrIncomplete are not cleared.
+func (p *Parser) Recover(syncSet string) bool {
+	if p.err == ErrEOF || p.err == ErrIncomplete {
+		return false
+	}
+	if p.err != nil {
+		p.errs = append(p.errs, p.err)
+		p.err = nil
 	}
+	p.ForwardUntil(syncSet)
+	p.Ignore()
+	_, ok := p.peek()
+	return ok
+}
 
-	end := p.pos + 5
+// Errors returns the collected errors followed by the current error, if any
+// ErrEOF is not included
+func (p *Parser) Errors() []error {
+	errs := append([]error(nil), p.errs...)
+	if p.failed() {
+		errs = append(errs, p.err)
+	}
+	return errs
+}
 
-	if end > len(p.input) {
-		end = len(p.input)
+// ErrorfSpan is like Errorf but for the span between the byte offsets start and end
+// the context is the line of start with the span underlined
+func (p *Parser) ErrorfSpan(start, end int, format string, args ...interface{}) {
+	if p.failed() || p.err == ErrIncomplete {
+		return
 	}
+	start, end = start-p.discarded, end-p.discarded
+	start = min(max(start, 0), len(p.input))
+	lineStart, lineEnd := p.lineStart(start), p.lineEnd(start)
+	end = max(min(end, lineEnd), start)
+	marker := p.marker(lineStart, start, utf8.RuneCountInString(p.input[start:end]))
+	p.setErr(p.newError(p.mapSource(p.positionOf(start)), fmt.Errorf(format, args...), p.input[lineStart:lineEnd]+"\n"+marker))
+}
 
-	p.err = errors.New(fmt.Sprintf(
-		"Error in line %d at position %d: %s\ncontext:\n%s\n",
-		p.line+1,
-		p.linepos+1,
-		fmt.Sprintf(format, args...),
-		p.input[start:end],
-	))
+// Parse parses input with the start state and returns the given root
+// together with the error returned by Run
+func Parse(input string, root ASTNode, start State, options ...Option) (ASTNode, error) {
+	return New(input, root, options...).RunResult(start)
 }
 
-func (p *Parser) Run(fn State) (err error) {
+// Run runs the states starting with fn, until a state returns nil or an error is set
+// errors collected by ErrorfContinue and Recover are joined with the error
+// see Feed for the ErrIncomplete
+func (p *Parser) Run(fn State) error {
 	for p.err == nil {
-		fn = fn(p)
+		if p.loopGuard > 0 && p.stuck(fn) {
+			break
+		}
+		if p.ctx != nil {
+			if p.err = p.ctx.Err(); p.err != nil {
+				break
+			}
+		}
+		var cp Checkpoint
+		if p.open() {
+			cp = p.Checkpoint()
+		}
+		next := p.call(fn)
+		if p.err == ErrIncomplete {
+			p.Rollback(cp)
+			p.resume = fn
+			return ErrIncomplete
+		}
+		fn = next
 		if fn == nil {
 			break
 		}
 	}
+	if len(p.astQueue) > 1 && (p.err == nil || p.err == ErrEOF) {
+		p.misuse("%d nodes not popped when Run returns", len(p.astQueue)-1)
+	}
+	if len(p.errs) > 0 {
+		return errors.Join(p.Errors()...)
+	}
 	if p.err == ErrEOF {
 		return nil
 	}
 
-	return err
+	return p.err
+}
+
+// ctxCheckRunes is the number of runes after which RunContext checks its context
+const ctxCheckRunes = 1024
+
+// RunContext is like Run but stops with the error of ctx, when ctx is done.
+// ctx is checked before each state and while reading every 1024 runes.
+func (p *Parser) RunContext(ctx context.Context, fn State) error {
+	p.ctx = ctx
+	defer func() { p.ctx = nil }()
+	return p.Run(fn)
+}
+
+// RunResult is like Run but also returns the root, which is partially
+// built, if an error occurred
+func (p *Parser) RunResult(fn State) (ASTNode, error) {
+	err := p.Run(fn)
+	return p.Root(), err
 }
@@ -0,0 +1,696 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// testNode is a node that keeps its children
+type testNode struct {
+	name     string
+	children []ASTNode
+}
+
+func (n *testNode) AddChild(c ASTNode) { n.children = append(n.children, c) }
+
+func (n *testNode) Children() []ASTNode { return n.children }
+
+func (n *testNode) SetChildren(c []ASTNode) { n.children = c }
+
+func (n *testNode) RemoveChild(c ASTNode) {
+	for i := len(n.children) - 1; i >= 0; i-- {
+		if n.children[i] == c {
+			n.children = append(n.children[:i], n.children[i+1:]...)
+			return
+		}
+	}
+}
+
+func TestEmitUpTo(t *testing.T) {
+	tests := []struct {
+		input   string
+		next    int
+		offset  int
+		emitted string
+		failed  bool
+	}{
+		{"ab", 2, 2, "ab", false},
+		{"ab", 2, 1, "a", false},
+		{"ab", 1, 0, "", false},
+		{"ab", 1, 2, "", true},
+		{"äb", 2, 1, "", true},
+		{"äb", 2, 2, "ä", false},
+	}
+	for _, test := range tests {
+		p := New(test.input, &testNode{})
+		for i := 0; i < test.next; i++ {
+			p.Next()
+		}
+		emitted := p.EmitUpTo(test.offset)
+		if emitted != test.emitted || p.failed() != test.failed {
+			t.Errorf("EmitUpTo(%d) on %q after %d Next = %q, error %v", test.offset, test.input, test.next, emitted, p.err)
+		}
+	}
+}
+
+func TestStrict(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		run    func(p *Parser)
+		misuse bool
+	}{
+		{"Next Backup", "ab", func(p *Parser) { p.Next(); p.Backup() }, false},
+		{"double Backup", "ab", func(p *Parser) { p.Next(); p.Backup(); p.Backup() }, true},
+		{"Backup after Peek", "ab", func(p *Parser) { p.Next(); p.Peek(); p.Backup() }, false},
+		{"Backup behind start", "ab", func(p *Parser) { p.Next(); p.Emit(); p.Backup() }, true},
+		{"Ignore after EOF", "a", func(p *Parser) { p.Next(); p.Next(); p.Ignore() }, true},
+		{"RestOfLine", "abc\r\ndef", func(p *Parser) { p.RestOfLine() }, false},
+		{"skipper", "  ab", func(p *Parser) {
+			p.SetSkipper(TriviaSkipper("//", "", ""))
+			p.Next()
+			p.Backup()
+		}, false},
+	}
+	for _, test := range tests {
+		p := New(test.input, &testNode{}, WithStrict())
+		test.run(p)
+		if err := p.CheckInvariants(); errors.Is(err, ErrMisuse) != test.misuse || errors.Is(err, ErrInvariant) {
+			t.Errorf("%s: CheckInvariants() = %v", test.name, err)
+		}
+	}
+}
+
+func TestStrictRun(t *testing.T) {
+	p := New("a", &testNode{}, WithStrict())
+	err := p.Run(func(p *Parser) State {
+		p.AddNode(&testNode{})
+		p.Next()
+		return nil
+	})
+	if !errors.Is(err, ErrMisuse) {
+		t.Errorf("unpopped node: Run() = %v", err)
+	}
+
+	p = New("a", &testNode{}, WithStrict())
+	err = p.Run(func(p *Parser) State {
+		p.AddNode(&testNode{})
+		p.Errorf("unexpected %q", p.Next())
+		return nil
+	})
+	if errors.Is(err, ErrMisuse) || p.Err() == nil {
+		t.Errorf("unpopped node after Errorf: Run() = %v", err)
+	}
+}
+
+func TestReplaceCurrentRollback(t *testing.T) {
+	root, a, b := &testNode{}, &testNode{name: "a"}, &testNode{name: "b"}
+	p := New("", root)
+	before := p.Checkpoint()
+	p.AddNode(a)
+	cp := p.Checkpoint()
+	if err := p.ReplaceCurrent(b); err != nil || root.children[0] != b || p.CurrentNode() != b {
+		t.Fatalf("ReplaceCurrent: %v", err)
+	}
+	p.Rollback(cp)
+	if len(root.children) != 1 || root.children[0] != a || p.CurrentNode() != a {
+		t.Errorf("after Rollback: children %v, current node %v", root.children, p.CurrentNode())
+	}
+	p.ReplaceCurrent(b)
+	p.Rollback(before)
+	if len(root.children) != 0 {
+		t.Errorf("after Rollback before AddNode: children %v", root.children)
+	}
+}
+
+func TestFeedCarriageReturn(t *testing.T) {
+	tests := []struct {
+		first, second string
+		line, column  int
+	}{
+		{"a\r", "\nb", 2, 2},
+		{"a\r", "b", 2, 2},
+		{"a\r", "", 2, 1},
+		{"a", "\r\nb", 2, 2},
+	}
+	for _, test := range tests {
+		p := New("", &testNode{})
+		p.Feed(test.first)
+		for p.Next(); !p.hitEnd(); p.Next() {
+		}
+		p.Feed(test.second)
+		p.Close()
+		p.err = nil
+		for p.Next(); !p.hitEnd(); p.Next() {
+		}
+		if pos := p.Pos(); pos.Line != test.line || pos.Column != test.column {
+			t.Errorf("Feed(%q), Feed(%q): line %d, column %d, want %d, %d", test.first, test.second, pos.Line, pos.Column, test.line, test.column)
+		}
+		if err := p.CheckInvariants(); err != nil {
+			t.Errorf("Feed(%q), Feed(%q): %v", test.first, test.second, err)
+		}
+	}
+}
+
+func TestPeekAtEOF(t *testing.T) {
+	tests := []struct {
+		input string
+		next  int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"a\n", 2},
+		{"a\r\n", 3},
+		{"ä", 1},
+	}
+	for _, test := range tests {
+		p := New(test.input, &testNode{})
+		for i := 0; i < test.next; i++ {
+			p.Next()
+		}
+		pos := p.Pos()
+		if r := p.Peek(); r != EOF {
+			t.Errorf("Peek() on %q = %q, want EOF", test.input, r)
+		}
+		if !p.IsEOF() || p.Pos() != pos || p.Err() != nil {
+			t.Errorf("after Peek() on %q: IsEOF() = %v, position %v, want %v", test.input, p.IsEOF(), p.Pos(), pos)
+		}
+		p.Next()
+		p.Backup()
+		if p.Pos() != pos {
+			t.Errorf("after Next() and Backup() at EOF on %q: position %v, want %v", test.input, p.Pos(), pos)
+		}
+	}
+}
+
+func TestAddNilNode(t *testing.T) {
+	root := &testNode{}
+	p := New("ab", root)
+	p.Next()
+	p.AddNode(nil)
+	if p.Err() == nil || p.Err().Column != 2 {
+		t.Errorf("AddNode(nil): error %v, want a positioned error", p.err)
+	}
+	if len(root.children) != 0 || p.Depth() != 0 || p.CurrentNode() != root {
+		t.Errorf("AddNode(nil) changed the tree: children %v, depth %d", root.children, p.Depth())
+	}
+	p.AddNode(&testNode{})
+	if len(root.children) != 1 {
+		t.Errorf("AddNode after AddNode(nil): children %v", root.children)
+	}
+}
+
+func TestEmptyInput(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(p *Parser) bool
+	}{
+		{"Peek", func(p *Parser) bool { return p.Peek() == EOF }},
+		{"Next", func(p *Parser) bool { return p.Next() == EOF && p.IsEOF() }},
+		{"Backup", func(p *Parser) bool { p.Backup(); return p.pos == 0 }},
+		{"PeekBack", func(p *Parser) bool { return p.PeekBack() == EOF }},
+		{"Accept", func(p *Parser) bool { return !p.Accept("a") }},
+		{"AcceptRun", func(p *Parser) bool { p.AcceptRun("a"); return p.pos == 0 }},
+		{"AcceptAny", func(p *Parser) bool { _, ok := p.AcceptAny(); return !ok }},
+		{"AcceptNewline", func(p *Parser) bool { return !p.AcceptNewline() }},
+		{"ForwardUntil", func(p *Parser) bool { return !p.ForwardUntil("a") }},
+		{"Emit", func(p *Parser) bool { return p.Emit() == "" }},
+		{"Ignore", func(p *Parser) bool { p.Ignore(); return p.start == 0 }},
+		{"RestOfLine", func(p *Parser) bool { return p.RestOfLine() == "" }},
+		{"Errorf", func(p *Parser) bool {
+			p.Errorf("empty input")
+			e := p.Err()
+			return e != nil && e.Line == 1 && e.Column == 1 && e.Context == "\n^"
+		}},
+	}
+	for _, test := range tests {
+		p := New("", &testNode{})
+		if !test.run(p) {
+			t.Errorf("%s on empty input failed, error %v", test.name, p.err)
+		}
+		if err := p.CheckInvariants(); err != nil {
+			t.Errorf("%s on empty input: %v", test.name, err)
+		}
+	}
+
+	p := New("", &testNode{})
+	err := p.Run(func(p *Parser) State {
+		if p.Peek() == EOF {
+			return nil
+		}
+		p.Errorf("unexpected %q", p.Next())
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Run on empty input = %v", err)
+	}
+}
+
+func TestRepeatedBackup(t *testing.T) {
+	tests := []struct {
+		input   string
+		next    int
+		backups int
+		offset  int
+		line    int
+		column  int
+		rune_   rune
+	}{
+		{"abc", 3, 2, 1, 1, 2, 'b'},
+		{"abc", 3, 3, 0, 1, 1, 'a'},
+		{"abc", 2, 5, 0, 1, 1, 'a'},
+		{"äöü", 3, 2, 2, 1, 2, 'ö'},
+		{"a\nb", 3, 2, 1, 1, 2, '\n'},
+		{"ab", 4, 2, 2, 1, 3, EOF},
+		{"ab", 4, 3, 1, 1, 2, 'b'},
+	}
+	for _, test := range tests {
+		p := New(test.input, &testNode{})
+		for i := 0; i < test.next; i++ {
+			p.Next()
+		}
+		for i := 0; i < test.backups; i++ {
+			p.Backup()
+		}
+		pos := p.Pos()
+		if pos.Offset != test.offset || pos.Line != test.line || pos.Column != test.column {
+			t.Errorf("%d Next, %d Backup on %q: position %v", test.next, test.backups, test.input, pos)
+		}
+		if r := p.Next(); r != test.rune_ {
+			t.Errorf("%d Next, %d Backup on %q: Next() = %q, want %q", test.next, test.backups, test.input, r, test.rune_)
+		}
+	}
+}
+
+func TestAcceptNewline(t *testing.T) {
+	tests := []struct {
+		input    string
+		accepted bool
+		offset   int
+		line     int
+		rest     string
+	}{
+		{"\nb", true, 1, 2, "b"},
+		{"\r\nb", true, 2, 2, "b"},
+		{"\rb", true, 1, 2, "b"},
+		{"\n\nb", true, 1, 2, "\nb"},
+		{"\r\rb", true, 1, 2, "\rb"},
+		{"b", false, 0, 1, "b"},
+		{"", false, 0, 1, ""},
+	}
+	for _, test := range tests {
+		p := New(test.input, &testNode{})
+		accepted := p.AcceptNewline()
+		pos := p.Pos()
+		if accepted != test.accepted || pos.Offset != test.offset || pos.Line != test.line || pos.Column != 1 || p.Remaining() != test.rest {
+			t.Errorf("AcceptNewline() on %q = %v at %v, remaining %q", test.input, accepted, pos, p.Remaining())
+		}
+		if err := p.CheckInvariants(); err != nil {
+			t.Errorf("AcceptNewline() on %q: %v", test.input, err)
+		}
+	}
+}
+
+func TestRestOfLine(t *testing.T) {
+	for _, input := range []string{"abc\ndef", "abc\r\ndef"} {
+		p := New(input, &testNode{})
+		line := p.RestOfLine()
+		newline := p.AcceptNewline()
+		p.Ignore()
+		if line != "abc" || !newline || p.RestOfLine() != "def" {
+			t.Errorf("RestOfLine() on %q = %q", input, line)
+		}
+	}
+}
+
+// spanNode is a node that records its span
+type spanNode struct {
+	testNode
+	start, end Position
+}
+
+func (n *spanNode) SetSpan(start, end Position) { n.start, n.end = start, end }
+
+func TestNestedSpans(t *testing.T) {
+	// the nodes are written as (name ...)
+	input := "(a (b (c)) (d))"
+	want := map[string][2]int{"a": {0, 15}, "b": {3, 10}, "c": {6, 9}, "d": {11, 14}}
+	got := map[string]*spanNode{}
+	p := New(input, &testNode{})
+	err := p.Run(func(p *Parser) State {
+		for {
+			switch p.Peek() {
+			case '(':
+				n := &spanNode{testNode: testNode{name: p.PeekString(2)[1:]}}
+				got[n.name] = n
+				p.StartNode(n)
+				p.Next()
+			case ')':
+				p.Next()
+				p.EndNode()
+			case EOF:
+				return nil
+			default:
+				p.Next()
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, span := range want {
+		n := got[name]
+		if n == nil || n.start.Offset != span[0] || n.end.Offset != span[1] {
+			t.Errorf("span of %s = %v - %v, want %v", name, n.start, n.end, span)
+		}
+	}
+}
+
+func TestIgnoreEmit(t *testing.T) {
+	// the steps are n for Next, b for Backup, i for Ignore and e for Emit
+	tests := []struct {
+		input   string
+		steps   string
+		emitted []string
+	}{
+		{"abcd", "nnie", []string{""}},
+		{"abcd", "nninne", []string{"cd"}},
+		{"abcd", "nenie", []string{"a", ""}},
+		{"abcd", "nneninne", []string{"ab", "d"}},
+		{"abcd", "nnibne", []string{"b"}},
+		{"abcd", "nnibbnne", []string{"ab"}},
+		{"abcd", "nnnbie", []string{""}},
+		{"abcd", "nnnnnie", []string{""}},
+		{"abcd", "nnnnnbe", []string{"abcd"}},
+		{"a\nb", "nnine", []string{"b"}},
+	}
+	for _, test := range tests {
+		p := New(test.input, &testNode{})
+		var emitted []string
+		for _, step := range test.steps {
+			switch step {
+			case 'n':
+				p.Next()
+			case 'b':
+				p.Backup()
+			case 'i':
+				p.Ignore()
+			case 'e':
+				emitted = append(emitted, p.Emit())
+			}
+		}
+		if strings.Join(emitted, "|") != strings.Join(test.emitted, "|") {
+			t.Errorf("%s on %q emitted %q, want %q", test.steps, test.input, emitted, test.emitted)
+		}
+		if err := p.CheckInvariants(); err != nil {
+			t.Errorf("%s on %q: %v", test.steps, test.input, err)
+		}
+	}
+}
+
+func TestPositionAcrossNewlines(t *testing.T) {
+	// the steps are n for Next, b for Backup and p for Peek
+	tests := []struct {
+		input  string
+		steps  string
+		line   int
+		column int
+	}{
+		{"a\nb", "nnb", 1, 2},
+		{"a\nb", "nnnbb", 1, 2},
+		{"a\nb", "nnpb", 1, 2},
+		{"a\nb", "npnpbpb", 1, 1},
+		{"a\r\nb", "nnnpbb", 1, 2},
+		{"a\r\nb", "nnnnbbb", 1, 2},
+		{"a\rb", "nnpbpn", 2, 1},
+		{"a\n\nb", "nnnbbn", 2, 1},
+		{"ä\nö\nü", "nnnnnbbbn", 2, 2},
+	}
+	for _, test := range tests {
+		p := New(test.input, &testNode{})
+		for _, step := range test.steps {
+			switch step {
+			case 'n':
+				p.Next()
+			case 'b':
+				p.Backup()
+			case 'p':
+				p.Peek()
+			}
+		}
+		if pos := p.Pos(); pos.Line != test.line || pos.Column != test.column {
+			t.Errorf("%s on %q: line %d, column %d, want %d, %d", test.steps, test.input, pos.Line, pos.Column, test.line, test.column)
+		}
+		if err := p.CheckInvariants(); err != nil {
+			t.Errorf("%s on %q: %v", test.steps, test.input, err)
+		}
+		if _, width := utf8.DecodeLastRuneInString(p.input[:p.pos]); width > 0 {
+			prev := p.positionOf(p.pos - width)
+			if p.linePrev+1 != prev.Line || p.lineposPrev+1 != prev.Column {
+				t.Errorf("%s on %q: previous line %d, column %d, want %d, %d", test.steps, test.input, p.linePrev+1, p.lineposPrev+1, prev.Line, prev.Column)
+			}
+		}
+	}
+}
+
+func TestSkipper(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(p *Parser) bool
+	}{
+		{"AcceptAny", func(p *Parser) bool {
+			r, ok := p.AcceptAny()
+			p.Emit()
+			_, more := p.AcceptAny()
+			return r == 'a' && ok && !more && p.err == nil && !p.IsEOF()
+		}},
+		{"AcceptRunSet", func(p *Parser) bool {
+			return p.AcceptRunSet(NewRuneSet("a")) == 1 && p.Emit() == "a"
+		}},
+		{"ForwardUntilSet", func(p *Parser) bool {
+			return p.ForwardUntilSet(NewRuneSet(" ")) && p.Emit() == "a"
+		}},
+		{"Peek", func(p *Parser) bool { return p.Peek() == 'a' && p.Emit() == "" }},
+	}
+	for _, test := range tests {
+		p := New(" /* x */ a  ", &testNode{})
+		p.SetSkipper(TriviaSkipper("//", "/*", "*/"))
+		if !test.run(p) {
+			t.Errorf("%s with skipper failed, error %v", test.name, p.err)
+		}
+	}
+}
+
+func TestRegion(t *testing.T) {
+	input := "ab\ncd 'x\ny' z"
+	tests := []struct {
+		start, end int
+		ok         bool
+	}{
+		{7, 10, true},
+		{0, len(input), true},
+		{5, 5, true},
+		{1, 20, false},
+		{-1, 2, false},
+		{3, 2, false},
+	}
+	for _, test := range tests {
+		for _, streaming := range []bool{false, true} {
+			p := New(input, &testNode{})
+			if streaming {
+				p = NewReader(strings.NewReader(input), &testNode{})
+			}
+			r := p.Region(test.start, test.end)
+			if (r != nil) != test.ok || (p.err != nil) == test.ok {
+				t.Errorf("Region(%d, %d), streaming %v: got parser %v, error %v", test.start, test.end, streaming, r != nil, p.err)
+				continue
+			}
+			if r == nil {
+				continue
+			}
+			if r.Input() != input[test.start:test.end] {
+				t.Errorf("Region(%d, %d), streaming %v: input %q", test.start, test.end, streaming, r.Input())
+			}
+			r.Next()
+			r.Errorf("bad")
+			if e := r.Err(); test.start < test.end && (e.Offset != test.start+1 || e.Line != p.positionOf(test.start+1).Line) {
+				t.Errorf("Region(%d, %d), streaming %v: error at offset %d, line %d", test.start, test.end, streaming, e.Offset, e.Line)
+			}
+		}
+	}
+}
+
+func TestScanHeredoc(t *testing.T) {
+	tests := []struct {
+		input       string
+		stripIndent bool
+		body        string
+		rest        string
+	}{
+		{"a\nb\nEND\nc", false, "a\nb", "\nc"},
+		{"a\r\nb\r\nEND\r\n", false, "a\nb", "\r\n"},
+		{"  a\r\n  END", true, "a", ""},
+		{"END", false, "", ""},
+		{"a\r\n\r\nEND", false, "a\n", ""},
+	}
+	for _, test := range tests {
+		p := New(test.input, &testNode{})
+		body, err := p.ScanHeredoc("END", test.stripIndent)
+		if err != nil || body != test.body || p.Remaining() != test.rest {
+			t.Errorf("ScanHeredoc on %q = %q, %v, remaining %q", test.input, body, err, p.Remaining())
+		}
+	}
+}
+
+// offsetNode is a node that records its span as byte offsets
+type offsetNode struct {
+	testNode
+	start, end int
+}
+
+func (n *offsetNode) SetSpan(start, end int) { n.start, n.end = start, end }
+
+func TestSpanned(t *testing.T) {
+	outer, inner := &offsetNode{}, &offsetNode{}
+	p := New("(a(b))", &testNode{})
+	p.StartNode(outer)
+	p.Next()
+	p.Next()
+	p.WithNode(inner, func() { p.AcceptString("(b)") })
+	p.Next()
+	p.EndNode()
+	if outer.start != 0 || outer.end != 6 || inner.start != 2 || inner.end != 5 {
+		t.Errorf("spans %d - %d and %d - %d, want 0 - 6 and 2 - 5", outer.start, outer.end, inner.start, inner.end)
+	}
+}
+
+func TestCurrentNodeText(t *testing.T) {
+	tests := []struct {
+		steps string // n for Next, b for Backup, a for AddNode
+		text  string
+	}{
+		{"nann", "bc"},
+		{"nanb", ""},
+		{"nab", ""},
+		{"nabn", ""},
+		{"nabnn", "b"},
+		{"ann", "ab"},
+	}
+	for _, test := range tests {
+		p := New("abcd", &testNode{})
+		for _, step := range test.steps {
+			switch step {
+			case 'n':
+				p.Next()
+			case 'b':
+				p.Backup()
+			case 'a':
+				p.AddNode(&testNode{})
+			}
+		}
+		if text := p.CurrentNodeText(); text != test.text {
+			t.Errorf("%s: CurrentNodeText() = %q, want %q", test.steps, text, test.text)
+		}
+	}
+}
+
+func TestOrElseDropsSoftErrors(t *testing.T) {
+	primary := func(p *Parser) State {
+		p.Next()
+		p.ErrorfContinue("odd")
+		p.Errorf("not a number")
+		return nil
+	}
+	fallback := func(p *Parser) State {
+		p.AcceptRun("ab")
+		return nil
+	}
+	p := New("ab", &testNode{})
+	if err := p.Run(OrElse(primary, fallback)); err != nil || len(p.Errors()) != 0 {
+		t.Errorf("Run() = %v, Errors() = %v", err, p.Errors())
+	}
+}
+
+func TestLoopGuardNamedStates(t *testing.T) {
+	var a, b, c State
+	a = NameState("a", func(p *Parser) State { return b })
+	b = NameState("b", func(p *Parser) State { return c })
+	c = NameState("c", func(p *Parser) State { return nil })
+	p := New("x", &testNode{}, WithLoopGuard(2))
+	if err := p.Run(a); err != nil {
+		t.Errorf("a, b, c at the same position: Run() = %v", err)
+	}
+
+	var loop State
+	loop = NameState("loop", func(p *Parser) State { return loop })
+	p = New("x", &testNode{}, WithLoopGuard(2))
+	err := p.Run(loop)
+	if err == nil || !strings.Contains(err.Error(), "state loop dispatched 3 times") {
+		t.Errorf("loop: Run() = %v", err)
+	}
+}
+
+func TestTraceNamedStates(t *testing.T) {
+	var word, space State
+	word = NameState("word", func(p *Parser) State {
+		p.AcceptRun("abc")
+		p.Ignore()
+		if p.Peek() == EOF {
+			return nil
+		}
+		return space
+	})
+	space = NameState("space", func(p *Parser) State {
+		p.AcceptRun(" ")
+		p.Ignore()
+		return word
+	})
+	var buf bytes.Buffer
+	p := New("ab c", &testNode{})
+	p.SetTrace(&buf)
+	if err := p.Run(word); err != nil {
+		t.Fatalf("Run() = %v", err)
+	}
+	want := `word at line 1, column 1: consumed "ab"
+space at line 1, column 3: consumed " "
+word at line 1, column 4: consumed "c"
+`
+	if got := buf.String(); got != want {
+		t.Errorf("trace = %q, want %q", got, want)
+	}
+}
+
+func TestTakeNIgnoresPending(t *testing.T) {
+	p := New("abcdef", &testNode{})
+	p.Next()
+	p.Next()
+	s, err := p.TakeN(2)
+	if s != "cd" || err != nil {
+		t.Errorf("TakeN(2) = %q, %v, want \"cd\", nil", s, err)
+	}
+}
+
+func TestMaxLinesWithBase(t *testing.T) {
+	p := New("a\nb\nc", &testNode{}, WithBase(10, 1), WithMaxLines(2))
+	for i := 0; i < 4; i++ {
+		p.Next()
+	}
+	if p.err != nil || p.Pos().Line != 12 {
+		t.Fatalf("reading 2 lines: err = %v, line %d", p.err, p.Pos().Line)
+	}
+	if p.Next(); !errors.Is(p.err, ErrMaxLines) {
+		t.Errorf("reading the third line: err = %v, want ErrMaxLines", p.err)
+	}
+}
+
+func TestPeekNNotPositive(t *testing.T) {
+	p := New("abc", &testNode{})
+	for _, n := range []int{0, -1} {
+		if runes := p.PeekN(n); runes != nil {
+			t.Errorf("PeekN(%d) = %q, want nil", n, runes)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package parser
+
+import "context"
+
+// pipelineBuffer is the capacity of the token channel of a Pipeline
+const pipelineBuffer = 64
+
+// Pipeline runs a lexer in its own goroutine and delivers its tokens
+// over a buffered channel to the consuming stage
+type Pipeline struct {
+	tokens chan Token
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// nopNode is the root of the lexer of a Pipeline, it drops its children
+type nopNode struct{}
+
+func (nopNode) AddChild(ASTNode) {}
+
+// NewPipeline starts lexing input with lexStart and returns the running pipeline.
+// Every token emitted by the lexer is sent over the channel returned by Tokens.
+// A consumer that stops before the channel is closed must call Stop.
+func NewPipeline(input string, lexStart State, options ...Option) *Pipeline {
+	ctx, cancel := context.WithCancel(context.Background())
+	pl := &Pipeline{
+		tokens: make(chan Token, pipelineBuffer),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	p := New(input, nopNode{}, options...)
+	p.tokenCh = pl.tokens
+	go func() {
+		defer close(pl.tokens)
+		defer cancel()
+		pl.err = p.RunContext(ctx, lexStart)
+		close(pl.done)
+	}()
+	return pl
+}
+
+// Tokens returns the channel of the tokens, it is closed when the lexer is finished
+func (pl *Pipeline) Tokens() <-chan Token {
+	return pl.tokens
+}
+
+// Stop stops the lexer, which drops the tokens that are not sent yet and closes the channel
+func (pl *Pipeline) Stop() {
+	pl.cancel()
+}
+
+// Err waits for the lexer to finish and returns its error (see Run)
+// After Stop, it is context.Canceled, unless the lexer finished before.
+func (pl *Pipeline) Err() error {
+	<-pl.done
+	return pl.err
+}
@@ -0,0 +1,152 @@
+package parser
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Position is a position in the input
+type Position struct {
+	Offset int    // byte offset, starting with 0
+	Line   int    // line, starting with 1
+	Column int    // column in runes, starting with 1
+	File   string // the file of Line and Column, see AddSourceMapping
+}
+
+// position returns the current position
+func (p *Parser) position() Position {
+	return p.mapSource(Position{Offset: p.discarded + p.pos, Line: p.line + 1, Column: p.linepos + 1})
+}
+
+// Pos returns the current position
+func (p *Parser) Pos() Position {
+	return p.position()
+}
+
+// StartPos returns the position of the start of the pending emit
+func (p *Parser) StartPos() Position {
+	return p.mapSource(Position{Offset: p.discarded + p.start, Line: p.startLine + 1, Column: p.startPos + 1})
+}
+
+// EmitWithPos is like Emit but also returns the position of the emitted text
+func (p *Parser) EmitWithPos() (string, Position) {
+	t := p.emit(0)
+	return t.Value, Position{Offset: t.StartOffset, Line: t.Line, Column: t.Column, File: t.File}
+}
+
+// positionOf computes the position of the given byte offset, without source mapping
+func (p *Parser) positionOf(offset int) Position {
+	return Position{Offset: p.discarded + offset, Line: p.baseLine + p.lineBreaks(0, offset) + 1, Column: p.column(offset) + 1}
+}
+
+// lineBreaks counts the line breaks between the byte offsets from and to
+func (p *Parser) lineBreaks(from, to int) (n int) {
+	for i := from; i < to; i++ {
+		if c := p.input[i]; (c == '\n' || c == '\r') && p.isLineBreak(i) {
+			n++
+		}
+	}
+	return
+}
+
+// ByteOffset returns the current position as byte offset, starting with 0
+func (p *Parser) ByteOffset() int {
+	return p.discarded + p.pos
+}
+
+// RuneColumn returns the column of the current position in runes, starting with 1
+func (p *Parser) RuneColumn() int {
+	return p.linepos + 1
+}
+
+// column returns the linepos of the given byte offset
+func (p *Parser) column(offset int) int {
+	lineStart := p.lineStart(offset)
+	col := utf8.RuneCountInString(p.input[lineStart:offset])
+	if lineStart == 0 {
+		col += p.baseCol
+	}
+	return col
+}
+
+// isLineBreak reports whether the byte at offset ends a line
+// lines end with \n, \r\n or \r
+func (p *Parser) isLineBreak(offset int) bool {
+	switch p.input[offset] {
+	case '\n':
+		return true
+	case '\r':
+		// while input may follow via Feed, a \r at the end is undecided
+		if offset+1 == len(p.input) {
+			return !p.open()
+		}
+		return p.input[offset+1] != '\n'
+	}
+	return false
+}
+
+// lineEnd returns the offset of the line break ending the line containing offset
+// or the length of the input for the last line
+func (p *Parser) lineEnd(offset int) int {
+	for {
+		i := strings.IndexAny(p.input[offset:], "\r\n")
+		if i >= 0 {
+			return offset + i
+		}
+		if p.src == nil {
+			return len(p.input)
+		}
+		p.fill(len(p.input) - p.pos + readChunk)
+	}
+}
+
+// lineStart returns the offset of the start of the line containing offset
+func (p *Parser) lineStart(offset int) int {
+	for {
+		i := strings.LastIndexAny(p.input[:offset], "\r\n")
+		if i < 0 || p.isLineBreak(i) {
+			return i + 1
+		}
+		offset = i
+	}
+}
+
+// AtStart reports whether the parser is positioned at the start of the input
+func (p *Parser) AtStart() bool {
+	return p.discarded+p.pos == 0
+}
+
+// Region returns a parser for the input between the byte offsets start and end.
+// Its root is the last node of p. Positions of the returned parser continue
+// those of p at start, so that its positions and errors refer to the whole
+// input of p, like its byte offsets. The source mappings are inherited,
+// the options (e.g. WithBase to set another start position) are not
+// but given as arguments.
+// If the offsets are not within the kept input, an error is set and nil is returned.
+func (p *Parser) Region(start, end int, options ...Option) *Parser {
+	from, to := start-p.discarded, end-p.discarded
+	p.fill(to - p.pos)
+	if from < 0 || from > to || to > len(p.input) {
+		p.Errorf("can't parse the region from byte offset %d to %d, the kept input is from %d to %d", start, end, p.discarded, p.discarded+len(p.input))
+		return nil
+	}
+	pos := p.positionOf(from)
+	r := New(p.input[from:to], p.Last(), append([]Option{WithBase(pos.Line, pos.Column)}, options...)...)
+	r.discarded = start
+	r.nodeStarts[0].Offset = start
+	r.sources = append([]sourceMapping(nil), p.sources...)
+	return r
+}
+
+// Remaining returns the input behind the current position
+func (p *Parser) Remaining() string {
+	p.fillAll()
+	return p.input[p.pos:]
+}
+
+// RemainingRuneCount returns the number of runes behind the current position
+// it counts them each time, so the costs grow with the remaining input
+func (p *Parser) RemainingRuneCount() int {
+	p.fillAll()
+	return utf8.RuneCountInString(p.input[p.pos:])
+}
@@ -0,0 +1,94 @@
+package parser
+
+import (
+	"io"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// readChunk is the number of bytes read at once from the reader of NewReader
+// input is only discarded in chunks of at least this size
+const readChunk = 4096
+
+// NewReader returns a parser that reads its input from r as it is needed.
+// Only the input from the start of the pending emit (see Emit) on is kept in
+// memory, so Backup can't step behind the last Emit or Ignore and rolling back
+// to a checkpoint before discarded input sets an error.
+// Byte offsets refer to the whole input read from r, while Input and
+// CurrentNodeText only return what is still kept.
+// Regexps (see AcceptRegexp) and Remaining read the whole rest of r.
+// A read error other than io.EOF ends the input and becomes the error of the parser.
+func NewReader(r io.Reader, root ASTNode, options ...Option) *Parser {
+	p := New("", root, options...)
+	p.src = r
+	p.streaming = true
+	return p
+}
+
+// fill reads from the reader, until at least n bytes behind the current position
+// are buffered or the reader is exhausted
+func (p *Parser) fill(n int) {
+	for p.src != nil && len(p.input)-p.pos < n {
+		if len(p.raw) == cap(p.raw) {
+			raw := make([]byte, len(p.raw), max(2*cap(p.raw), len(p.raw)+max(readChunk, n)))
+			copy(raw, p.raw)
+			p.raw = raw
+		}
+		m, err := p.src.Read(p.raw[len(p.raw):cap(p.raw)])
+		p.setRaw(p.raw[:len(p.raw)+m])
+		if err != nil {
+			if err != io.EOF {
+				p.srcErr = err
+			}
+			p.src = nil
+		}
+	}
+}
+
+// setRaw sets the kept input of NewReader. The input aliases raw without copying it,
+// which is safe, since the bytes of raw up to its length are never written again:
+// fill reads behind them and compact copies the kept input to a new raw.
+func (p *Parser) setRaw(raw []byte) {
+	p.raw = raw
+	p.input = unsafe.String(unsafe.SliceData(raw), len(raw))
+}
+
+// fillAll reads the rest of the reader
+func (p *Parser) fillAll() {
+	for p.src != nil {
+		p.fill(len(p.input) - p.pos + readChunk)
+	}
+}
+
+// compact discards the input before the pending emit, keeping the rune before it
+// for PeekBack. The line and column of the kept input become the base.
+func (p *Parser) compact() {
+	if !p.streaming {
+		return
+	}
+	k := p.start
+	if k > 0 {
+		_, width := utf8.DecodeLastRuneInString(p.input[:k])
+		k -= width
+	}
+	if k < readChunk {
+		return
+	}
+	pos := p.positionOf(k)
+	p.baseLine, p.baseCol = pos.Line-1, pos.Column-1
+	raw := make([]byte, len(p.raw)-k, len(p.raw)-k+readChunk)
+	copy(raw, p.raw[k:])
+	p.setRaw(raw)
+	p.discarded += k
+	p.pos -= k
+	p.start -= k
+	p.guardPos -= k
+	i := 0
+	for i < len(p.reads) && p.reads[i].pos < k {
+		i++
+	}
+	p.reads = append(p.reads[:0], p.reads[i:]...)
+	for i := range p.reads {
+		p.reads[i].pos -= k
+	}
+}
@@ -0,0 +1,46 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestNewReader(t *testing.T) {
+	input := strings.Repeat("word\n", 5000) + strings.Repeat("x", 3*readChunk) + " end"
+	readers := map[string]func() *Parser{
+		"string":     func() *Parser { return New(input, &testNode{}) },
+		"reader":     func() *Parser { return NewReader(strings.NewReader(input), &testNode{}) },
+		"one byte":   func() *Parser { return NewReader(iotest.OneByteReader(strings.NewReader(input)), &testNode{}) },
+		"half":       func() *Parser { return NewReader(iotest.HalfReader(strings.NewReader(input)), &testNode{}) },
+		"data error": func() *Parser { return NewReader(iotest.DataErrReader(strings.NewReader(input)), &testNode{}) },
+	}
+	for name, newParser := range readers {
+		p := newParser()
+		var words []string
+		for {
+			p.AcceptRunFunc(func(r rune) bool { return r != '\n' && r != ' ' })
+			words = append(words, p.Emit())
+			if _, ok := p.AcceptAny(); !ok {
+				break
+			}
+			p.Ignore()
+		}
+		// the emitted words must not change, when the input is compacted
+		if len(words) != 5002 || strings.Join(words, "\n") != strings.Replace(input, " ", "\n", 1) {
+			t.Errorf("%s: %d words", name, len(words))
+		}
+		if pos := p.Pos(); pos.Offset != len(input) || pos.Line != 5001 || p.err != nil && p.err != ErrEOF {
+			t.Errorf("%s: end at %v, error %v", name, pos, p.err)
+		}
+	}
+}
+
+func TestNewReaderLongToken(t *testing.T) {
+	input := strings.Repeat("x", 1<<20)
+	p := NewReader(iotest.OneByteReader(strings.NewReader(input)), &testNode{})
+	p.AcceptRun("x")
+	if p.Emit() != input {
+		t.Errorf("token of %d bytes not emitted", len(input))
+	}
+}
@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"regexp"
+	"unicode/utf8"
+)
+
+// Matcher returns the number of bytes of the input that match at the current
+// position of p, or -1 if nothing matches. It must not consume anything.
+type Matcher func(p *Parser) int
+
+// Literal matches s, see WithCaseInsensitive
+func Literal(s string) Matcher {
+	return func(p *Parser) int {
+		if s == "" {
+			return -1
+		}
+		return p.matchLiteral(s)
+	}
+}
+
+// Class matches a run of runes satisfying pred
+func Class(pred func(rune) bool) Matcher {
+	return func(p *Parser) int {
+		n := 0
+		for p.fill(n + utf8.UTFMax); n < len(p.input)-p.pos; p.fill(n + utf8.UTFMax) {
+			r, width := utf8.DecodeRuneInString(p.input[p.pos+n:])
+			if p.filter != nil {
+				r = p.filter(r)
+			}
+			if !pred(r) {
+				break
+			}
+			n += width
+		}
+		if n == 0 {
+			return -1
+		}
+		return n
+	}
+}
+
+// Pattern matches re at the current position, see AcceptRegexp
+func Pattern(re *regexp.Regexp) Matcher {
+	return func(p *Parser) int {
+		if n := p.matchRegexp(re); n > 0 {
+			return n
+		}
+		return -1
+	}
+}
+
+// RuleSet is a declarative lexer: a list of matchers and the kinds of the tokens they produce
+type RuleSet struct {
+	rules []rule
+}
+
+type rule struct {
+	match Matcher
+	kind  TokenKind
+}
+
+// Add adds a rule producing tokens of the given kind for the input matched by m
+func (rs *RuleSet) Add(m Matcher, kind TokenKind) {
+	rs.rules = append(rs.rules, rule{m, kind})
+}
+
+// Lex tokenizes the remaining input of p. At each position the rule with
+// the longest match produces the next token; on a tie the rule added first wins.
+// If no rule matches, an error is set and returned along with the tokens so far.
+func (rs *RuleSet) Lex(p *Parser) ([]Token, error) {
+	return p.Tokenize(func(p *Parser) (Token, bool) {
+		p.skip()
+		if p.fill(1); p.pos >= len(p.input) {
+			return Token{}, false
+		}
+		longest, kind := 0, TokenKind(0)
+		for _, r := range rs.rules {
+			if n := r.match(p); n > longest {
+				longest, kind = n, r.kind
+			}
+		}
+		if longest == 0 {
+			r, _ := utf8.DecodeRuneInString(p.input[p.pos:])
+			p.Errorf("no rule matches %q", r)
+			return Token{}, false
+		}
+		p.advance(longest)
+		return p.EmitToken(kind), true
+	})
+}
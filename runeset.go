@@ -0,0 +1,129 @@
+package parser
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// RuneSet is a compiled set of runes for the hot paths of lexers
+// the ASCII runes are kept in a bitmap, the others in a map
+type RuneSet struct {
+	ascii [2]uint64
+	other map[rune]bool
+}
+
+// NewRuneSet returns the set of the runes in s
+func NewRuneSet(s string) *RuneSet {
+	rs := &RuneSet{}
+	for _, r := range s {
+		if r < 128 {
+			rs.ascii[r>>6] |= 1 << (r & 63)
+			continue
+		}
+		if rs.other == nil {
+			rs.other = map[rune]bool{}
+		}
+		rs.other[r] = true
+	}
+	return rs
+}
+
+// Contains reports whether r is in the set
+func (rs *RuneSet) Contains(r rune) bool {
+	if r >= 0 && r < 128 {
+		return rs.ascii[r>>6]&(1<<(r&63)) != 0
+	}
+	return rs.other[r]
+}
+
+// inRuneSet is like inSet for a RuneSet
+func (p *Parser) inRuneSet(rs *RuneSet, r rune) bool {
+	if rs.Contains(r) {
+		return true
+	}
+	if !p.fold {
+		return false
+	}
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if rs.Contains(f) {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptSet is like Accept for a RuneSet
+func (p *Parser) AcceptSet(rs *RuneSet) bool {
+	r := p.Next()
+	if !p.hitEnd() && p.inRuneSet(rs, r) {
+		return true
+	}
+	p.backup()
+	return false
+}
+
+// AcceptRunSet is like AcceptRun for a RuneSet but returns the number of accepted runes
+func (p *Parser) AcceptRunSet(rs *RuneSet) (count int) {
+	p.skip()
+	for {
+		count += p.skipASCII(rs, true)
+		if !p.AcceptSet(rs) {
+			return
+		}
+		count++
+	}
+}
+
+// ForwardUntilSet is like ForwardUntil for a RuneSet
+func (p *Parser) ForwardUntilSet(rs *RuneSet) (found bool) {
+	p.skip()
+	err := p.err
+	for {
+		p.skipASCII(rs, false)
+		r := p.Next()
+		if p.hitEnd() || p.inRuneSet(rs, r) {
+			break
+		}
+	}
+	found = !p.hitEnd()
+	p.backup()
+	if p.err == ErrEOF {
+		p.err = err
+	}
+	return
+}
+
+// skipASCII is the fast path of reading: it consumes the ASCII runes
+// other than line breaks that are in rs (or not in rs, if in is false) at once
+// and returns their number. Where a rune needs more care than counting the
+// column, e.g. because of a filter or a limit, it stops and leaves it to Next.
+func (p *Parser) skipASCII(rs *RuneSet, in bool) int {
+	if len(p.pushback) > 0 || p.filter != nil || p.fold || p.ctx != nil || p.maxLines > 0 && p.line-p.firstLine >= p.maxLines {
+		return 0
+	}
+	end := len(p.input)
+	if p.maxBytes > 0 {
+		end = min(end, p.maxBytes-p.discarded)
+	}
+	if p.maxRunes > 0 {
+		end = min(end, p.pos+p.maxRunes-p.stats.Runes)
+	}
+	i := p.pos
+	for i < end {
+		c := p.input[i]
+		if c >= utf8.RuneSelf || c == '\n' || c == '\r' || rs.ascii[c>>6]&(1<<(c&63)) != 0 != in {
+			break
+		}
+		i++
+	}
+	n := i - p.pos
+	if n <= 0 {
+		return 0
+	}
+	p.dropStaleEOF()
+	p.pos, p.width, p.ungot = i, 1, false
+	p.stats.Runes += n
+	p.linePrev, p.lineposPrev = p.line, p.linepos+n-1
+	p.linepos += n
+	return n
+}
@@ -0,0 +1,93 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+// parserState is the state of a parser that the fast path of RuneSet must keep right
+type parserState struct {
+	pos, line, linepos    int
+	linePrev, lineposPrev int
+	stats                 Stats
+	err                   string
+}
+
+func stateOf(p *Parser) parserState {
+	s := parserState{pos: p.pos, line: p.line, linepos: p.linepos, linePrev: p.linePrev, lineposPrev: p.lineposPrev, stats: p.stats}
+	if p.err != nil {
+		s.err = p.err.Error()
+	}
+	return s
+}
+
+func TestRuneSetFastPath(t *testing.T) {
+	const set = "abc \t"
+	inputs := []string{"", "abc", "abcd", "ab\ncd", "a b\r\nc", "aöb", "öab", "xyz", "abcabcabc\tx", "ab ab ab"}
+	options := [][]Option{nil, {WithMaxRunes(2)}, {WithMaxBytes(3)}, {WithMaxLines(1)}, {WithBase(3, 5)}}
+	for _, input := range inputs {
+		for i, opts := range options {
+			for prefix := 0; prefix <= 1; prefix++ {
+				slow := New(input, &testNode{}, opts...)
+				fast := New(input, &testNode{}, opts...)
+				for j := 0; j < prefix; j++ {
+					slow.Next()
+					fast.Next()
+				}
+				slow.AcceptRun(set)
+				fast.AcceptRunSet(NewRuneSet(set))
+				if stateOf(slow) != stateOf(fast) {
+					t.Errorf("AcceptRunSet on %q with options %d after %d Next: %+v, AcceptRun: %+v", input, i, prefix, stateOf(fast), stateOf(slow))
+				}
+				slow.Backup()
+				fast.Backup()
+				if stateOf(slow) != stateOf(fast) || slow.Next() != fast.Next() {
+					t.Errorf("Backup after AcceptRunSet on %q with options %d after %d Next: %+v, AcceptRun: %+v", input, i, prefix, stateOf(fast), stateOf(slow))
+				}
+				if err := fast.CheckInvariants(); err != nil {
+					t.Errorf("AcceptRunSet on %q with options %d: %v", input, i, err)
+				}
+
+				slow = New(input, &testNode{}, opts...)
+				fast = New(input, &testNode{}, opts...)
+				slowFound := slow.ForwardUntil("\nc")
+				fastFound := fast.ForwardUntilSet(NewRuneSet("\nc"))
+				if slowFound != fastFound || stateOf(slow) != stateOf(fast) {
+					t.Errorf("ForwardUntilSet on %q with options %d: %v %+v, ForwardUntil: %v %+v", input, i, fastFound, stateOf(fast), slowFound, stateOf(slow))
+				}
+			}
+		}
+	}
+}
+
+var benchmarkInput = strings.Repeat("abcdefghij", 10000) + "!"
+
+func BenchmarkAcceptRun(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		p := New(benchmarkInput, &testNode{})
+		p.AcceptRun("abcdefghij")
+	}
+}
+
+func BenchmarkAcceptRunSet(b *testing.B) {
+	rs := NewRuneSet("abcdefghij")
+	for i := 0; i < b.N; i++ {
+		p := New(benchmarkInput, &testNode{})
+		p.AcceptRunSet(rs)
+	}
+}
+
+func BenchmarkForwardUntil(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		p := New(benchmarkInput, &testNode{})
+		p.ForwardUntil("!?")
+	}
+}
+
+func BenchmarkForwardUntilSet(b *testing.B) {
+	rs := NewRuneSet("!?")
+	for i := 0; i < b.N; i++ {
+		p := New(benchmarkInput, &testNode{})
+		p.ForwardUntilSet(rs)
+	}
+}
@@ -0,0 +1,295 @@
+package parser
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TakeN consumes and emits exactly n runes, input pending before is ignored
+// if the input ends before, an error is set and returned
+func (p *Parser) TakeN(n int) (string, error) {
+	p.Ignore()
+	for i := 0; i < n; i++ {
+		p.Next()
+		if p.hitEnd() {
+			p.Errorf("expected %d runes, but only %d are available", n, i)
+			return "", p.err
+		}
+	}
+	return p.Emit(), nil
+}
+
+// ForwardUntilEscaped runs forward until the first delim that is not
+// protected by a preceding escape and returns the raw text in between
+// (escapes are kept). The parser stays positioned before delim.
+// If the input ends before delim, an error is set and returned.
+func (p *Parser) ForwardUntilEscaped(delim, escape rune) (string, error) {
+	p.skip()
+	begin := p.pos
+	for {
+		r := p.Next()
+		switch {
+		case p.hitEnd():
+			p.Errorf("missing closing %q", delim)
+			return "", p.err
+		case r == escape:
+			p.Next()
+			if p.hitEnd() {
+				p.Errorf("missing closing %q", delim)
+				return "", p.err
+			}
+		case r == delim:
+			p.backup()
+			return p.input[begin:p.pos], nil
+		}
+	}
+}
+
+// SkipTrivia consumes and ignores any sequence of whitespace, line comments
+// and block comments and returns whether anything was skipped.
+// Line comments start with lineComment and end before the next newline,
+// block comments are enclosed by blockOpen and blockClose.
+// An empty lineComment or blockOpen disables the respective comments.
+// An unterminated block comment sets an error.
+func (p *Parser) SkipTrivia(lineComment, blockOpen, blockClose string) bool {
+	begin := p.pos
+	for {
+		switch {
+		case unicode.IsSpace(p.Peek()):
+			p.Next()
+		case lineComment != "" && p.acceptLiteral(lineComment):
+			p.ForwardUntil("\n")
+		case blockOpen != "" && p.acceptLiteral(blockOpen):
+			for !p.acceptLiteral(blockClose) {
+				p.Next()
+				if p.hitEnd() {
+					p.Errorf("unterminated comment, missing %q", blockClose)
+					return true
+				}
+			}
+		default:
+			skipped := p.pos != begin
+			p.Ignore()
+			return skipped
+		}
+	}
+}
+
+// ScanHeredoc reads lines until a line equals terminator and returns the lines
+// before it joined by \n. Lines may also end with \r\n. The terminator is consumed,
+// the line break behind it is not.
+// If stripIndent is set, leading spaces and tabs are ignored when looking for the
+// terminator and removed from the returned lines.
+// If the input ends before the terminator, an error is set and returned.
+func (p *Parser) ScanHeredoc(terminator string, stripIndent bool) (string, error) {
+	startLine := p.line
+	var lines []string
+	for {
+		begin := p.pos
+		p.ForwardUntil("\n")
+		line, crlf := strings.CutSuffix(p.input[begin:p.pos], "\r")
+		if stripIndent {
+			line = strings.TrimLeft(line, " \t")
+		}
+		if line == terminator {
+			if crlf {
+				p.backup()
+			}
+			return strings.Join(lines, "\n"), nil
+		}
+		if !p.AcceptRune('\n') {
+			p.Errorf("heredoc starting in line %d is missing the terminator %q", startLine+1, terminator)
+			return "", p.err
+		}
+		lines = append(lines, line)
+	}
+}
+
+// RestOfLine consumes and emits the input up to the end of the line.
+// The line break, \n or \r\n, is not consumed.
+func (p *Parser) RestOfLine() string {
+	p.ForwardUntil("\n")
+	if p.PeekBack() == '\r' && p.pos > p.start {
+		p.backup()
+	}
+	return p.Emit()
+}
+
+// ScanBasedInteger consumes an integer literal and returns its text and base.
+// The prefixes 0x, 0o and 0b (case insensitive) select the bases 16, 8 and 2,
+// without prefix the base is 10. Digits may be separated by underscores.
+// If no digits are found, an error is set and returned.
+func (p *Parser) ScanBasedInteger() (value string, base int, err error) {
+	p.skip()
+	begin := p.pos
+	base, digits := 10, "0123456789"
+	p.fill(2)
+	if strings.HasPrefix(p.input[p.pos:], "0") && len(p.input) > p.pos+1 {
+		switch p.input[p.pos+1] {
+		case 'x', 'X':
+			base, digits = 16, "0123456789abcdefABCDEF"
+		case 'o', 'O':
+			base, digits = 8, "01234567"
+		case 'b', 'B':
+			base, digits = 2, "01"
+		}
+	}
+	if base != 10 {
+		p.advance(2)
+		p.AcceptRun("_")
+	}
+	if !p.Accept(digits) {
+		if base == 10 {
+			p.Errorf("expected an integer")
+		} else {
+			p.Errorf("missing digits after %q", p.input[begin:begin+2])
+		}
+		return "", base, p.err
+	}
+	p.AcceptRun(digits + "_")
+	return p.input[begin:p.pos], base, nil
+}
+
+// SkipToNextLine consumes and ignores the input up to and including the next
+// line break (\n, \r\n or \r) or up to the end of the input
+func (p *Parser) SkipToNextLine() {
+	p.ForwardUntil("\r\n")
+	p.AcceptNewline()
+	p.Ignore()
+}
+
+// ScanNumber consumes a decimal number with optional fraction and exponent,
+// e.g. 12, 1.5, .5 or 6.02e+23, and returns its text. A dot or an exponent
+// marker that is not followed by digits is not consumed. If there are no
+// digits at the current position, nothing is consumed and false is returned.
+func (p *Parser) ScanNumber() (string, bool) {
+	p.skip()
+	begin := p.pos
+	digits := p.AcceptRunFunc(isDecimal)
+	if r, _ := p.peek(); r == '.' {
+		cp := p.Checkpoint()
+		p.Next()
+		fraction := p.AcceptRunFunc(isDecimal)
+		if fraction == 0 {
+			p.Rollback(cp)
+		}
+		digits += fraction
+	}
+	if digits == 0 {
+		return "", false
+	}
+	cp := p.Checkpoint()
+	if p.Accept("eE") {
+		p.Accept("+-")
+		if p.AcceptRunFunc(isDecimal) == 0 {
+			p.Rollback(cp)
+		}
+	}
+	return p.input[begin:p.pos], true
+}
+
+func isDecimal(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// ScanIdentifier consumes an identifier and returns it. It consists of runes
+// satisfying the predicate set via WithIdentRune and does not start with a digit.
+func (p *Parser) ScanIdentifier() (string, bool) {
+	p.skip()
+	begin := p.pos
+	if !p.AcceptFunc(func(r rune) bool { return p.identRune(r) && !unicode.IsDigit(r) }) {
+		return "", false
+	}
+	p.AcceptRunFunc(p.identRune)
+	return p.input[begin:p.pos], true
+}
+
+// ScanQuotedString consumes a string enclosed by quote and returns its content
+// with the escape sequences replaced. The escapes are \a \b \f \n \r \t \v \\,
+// the escaped quote and \xHH, \uHHHH and \UHHHHHHHH for code points.
+// If the string is not terminated or contains an invalid escape, an error
+// pointing at the opening quote or the escape is set and returned.
+func (p *Parser) ScanQuotedString(quote rune) (string, error) {
+	p.skip()
+	open := p.ByteOffset()
+	if !p.AcceptRune(quote) {
+		p.Errorf("expected %q", quote)
+		return "", p.err
+	}
+	var sb strings.Builder
+	for {
+		at := p.ByteOffset()
+		r := p.Next()
+		switch {
+		case p.hitEnd():
+			p.ErrorfSpan(open, open+utf8.RuneLen(quote), "unterminated string, missing closing %q", quote)
+			return "", p.err
+		case r == quote:
+			return sb.String(), nil
+		case r == '\\':
+			r, ok := p.scanEscape(quote)
+			if !ok {
+				if p.hitEnd() {
+					p.ErrorfSpan(open, open+utf8.RuneLen(quote), "unterminated string, missing closing %q", quote)
+				} else {
+					p.ErrorfSpan(at, p.ByteOffset(), "invalid escape sequence")
+				}
+				return "", p.err
+			}
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+}
+
+var escapes = map[rune]rune{'a': '\a', 'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t', 'v': '\v', '\\': '\\'}
+
+// scanEscape consumes the escape sequence behind a backslash and returns the rune it stands for
+func (p *Parser) scanEscape(quote rune) (rune, bool) {
+	r := p.Next()
+	if p.hitEnd() {
+		return 0, false
+	}
+	if r == quote {
+		return r, true
+	}
+	if e, has := escapes[r]; has {
+		return e, true
+	}
+	var n int
+	switch r {
+	case 'x':
+		n = 2
+	case 'u':
+		n = 4
+	case 'U':
+		n = 8
+	default:
+		return 0, false
+	}
+	var v rune
+	for i := 0; i < n; i++ {
+		d := p.Next()
+		if p.hitEnd() {
+			return 0, false
+		}
+		if !unicode.Is(unicode.ASCII_Hex_Digit, d) {
+			p.backup()
+			return 0, false
+		}
+		v = v<<4 | hexValue(d)
+	}
+	return v, utf8.ValidRune(v)
+}
+
+func hexValue(d rune) rune {
+	switch {
+	case d >= 'a':
+		return d - 'a' + 10
+	case d >= 'A':
+		return d - 'A' + 10
+	}
+	return d - '0'
+}
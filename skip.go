@@ -0,0 +1,51 @@
+package parser
+
+// SetSkipper sets a skipper that consumes whitespace, comments etc. between tokens.
+// The parser runs it at a token boundary, i.e. when nothing has been read since
+// the last Emit or Ignore, before Next, Peek, the Accept functions and the scanners
+// look at the input. What the skipper consumes is ignored, its returned State
+// is not used. SetSkipper(nil) removes the skipper, see also WithoutSkipper.
+func (p *Parser) SetSkipper(skipper State) {
+	p.skipper = skipper
+	p.skipped = 0
+}
+
+// WithoutSkipper runs fn with the skipper disabled, e.g. to scan a string literal
+// that starts with whitespace. For a literal that is scanned by several states,
+// remove the skipper with SetSkipper(nil) and set it again when the literal is done.
+func (p *Parser) WithoutSkipper(fn func()) {
+	skipper := p.skipper
+	p.skipper = nil
+	defer func() { p.skipper = skipper }()
+	fn()
+}
+
+// TriviaSkipper returns a skipper for SetSkipper that runs SkipTrivia
+func TriviaSkipper(lineComment, blockOpen, blockClose string) State {
+	return func(p *Parser) State {
+		p.SkipTrivia(lineComment, blockOpen, blockClose)
+		return nil
+	}
+}
+
+// skip runs the skipper, if the parser is at a token boundary
+// where it has not run yet
+func (p *Parser) skip() {
+	if p.skipper == nil || p.skipping || p.pos != p.start || len(p.pushback) > 0 ||
+		p.skipped == p.discarded+p.pos+1 || p.failed() {
+		return
+	}
+	err, atEOF := p.err, p.atEOF
+	p.skipping = true
+	p.skipper(p)
+	p.skipping = false
+	// hitting the end while skipping is left to the next read
+	if p.err == ErrEOF {
+		p.err, p.atEOF = err, atEOF
+	}
+	if p.failed() || p.err == ErrIncomplete {
+		return
+	}
+	p.Ignore()
+	p.skipped = p.discarded + p.pos + 1
+}
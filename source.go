@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrOffsetNotKept is returned by AddSourceMapping for an offset outside of the kept input
+var ErrOffsetNotKept = errors.New("byte offset is not within the kept input")
+
+// sourceMapping maps the input from a position on to a line of a file
+type sourceMapping struct {
+	from Position // the position in the input, Line and Column not mapped
+	file string
+	line int
+}
+
+// AddSourceMapping lets the positions from the byte offset on refer to the given
+// file, where the line at offset is line (starting with 1), e.g. for input that is
+// assembled from several files. The offset should be at the start of a line;
+// otherwise the columns of its line are counted from offset on.
+// A mapping replaces a former one at the same offset.
+// Byte offsets of positions and errors still refer to the input.
+func (p *Parser) AddSourceMapping(offset int, file string, line int) error {
+	k := offset - p.discarded
+	p.fill(k - p.pos)
+	if k < 0 || k > len(p.input) {
+		return ErrOffsetNotKept
+	}
+	m := sourceMapping{from: p.positionOf(k), file: file, line: line}
+	i := sort.Search(len(p.sources), func(i int) bool { return p.sources[i].from.Offset >= offset })
+	if i < len(p.sources) && p.sources[i].from.Offset == offset {
+		p.sources[i] = m
+		return nil
+	}
+	p.sources = append(p.sources, sourceMapping{})
+	copy(p.sources[i+1:], p.sources[i:])
+	p.sources[i] = m
+	return nil
+}
+
+// PushSource lets the positions from the current position on refer to line of the
+// file name, like AddSourceMapping, e.g. behind the line break of an include directive.
+// PopSource returns to the source that was current before.
+func (p *Parser) PushSource(name string, line int) {
+	p.sourceStack = append(p.sourceStack, p.Pos())
+	p.AddSourceMapping(p.ByteOffset(), name, line)
+}
+
+// PopSource lets the positions from the current position on continue the source
+// that was current when PushSource was called. It returns false, if no source was pushed.
+func (p *Parser) PopSource() bool {
+	n := len(p.sourceStack)
+	if n == 0 {
+		return false
+	}
+	outer := p.sourceStack[n-1]
+	p.sourceStack = p.sourceStack[:n-1]
+	p.AddSourceMapping(p.ByteOffset(), outer.File, outer.Line)
+	return true
+}
+
+// mapSource returns pos with the line, column and file of the source mapping
+// that covers its offset
+func (p *Parser) mapSource(pos Position) Position {
+	i := sort.Search(len(p.sources), func(i int) bool { return p.sources[i].from.Offset > pos.Offset }) - 1
+	if i < 0 {
+		return pos
+	}
+	m := p.sources[i]
+	if pos.Line == m.from.Line {
+		pos.Column -= m.from.Column - 1
+	}
+	pos.Line += m.line - m.from.Line
+	pos.File = m.file
+	return pos
+}
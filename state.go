@@ -0,0 +1,166 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"unsafe"
+)
+
+// NameState wraps s, so that the parser knows the name of the state while it runs
+// the names of the running states are reported by StateStack and
+// are part of the errors set via Errorf
+func NameState(name string, s State) State {
+	return func(p *Parser) State {
+		if slot := p.nameSlot; slot != nil {
+			p.nameSlot = nil
+			*slot = name
+		}
+		p.states = append(p.states, name)
+		defer p.popState()
+		return s(p)
+	}
+}
+
+func (p *Parser) popState() {
+	p.states = p.states[:len(p.states)-1]
+}
+
+// StateName returns the name of the innermost running named state
+// or the empty string, if no named state is running
+func (p *Parser) StateName() string {
+	if len(p.states) == 0 {
+		return ""
+	}
+	return p.states[len(p.states)-1]
+}
+
+// StateStack returns the names of the running named states, outermost first
+func (p *Parser) StateStack() []string {
+	return append([]string(nil), p.states...)
+}
+
+// stateFunc returns the name of the function of s
+func stateFunc(s State) string {
+	f := runtime.FuncForPC(reflect.ValueOf(s).Pointer())
+	if f == nil {
+		return "unknown"
+	}
+	return f.Name()
+}
+
+// namedStatePC is the code pointer shared by all closures of NameState
+var namedStatePC = reflect.ValueOf(NameState("", nil)).Pointer()
+
+// stateKey identifies s for the loop guard by its code pointer,
+// but a closure of NameState by the closure itself, since they share the code
+func stateKey(s State) uintptr {
+	pc := reflect.ValueOf(s).Pointer()
+	if pc != namedStatePC {
+		return pc
+	}
+	return uintptr(*(*unsafe.Pointer)(unsafe.Pointer(&s)))
+}
+
+// stateName returns the name of s: the one given to RunGrammar or NameState
+// (known once s has been run by call) or the name of the function
+func (p *Parser) stateName(s State) string {
+	if name, has := p.names[reflect.ValueOf(s).Pointer()]; has {
+		return name
+	}
+	if p.lastName != "" && stateKey(s) == p.guardKey {
+		return p.lastName
+	}
+	return stateFunc(s)
+}
+
+// stuck reports whether the loop guard detected that fn is dispatched
+// again and again without progress. If so, the error is set.
+func (p *Parser) stuck(fn State) bool {
+	key := stateKey(fn)
+	if key != p.guardKey || p.pos != p.guardPos {
+		p.guardKey, p.guardPos, p.guardCount = key, p.pos, 0
+	}
+	p.guardCount++
+	if p.guardCount <= p.loopGuard {
+		return false
+	}
+	p.Errorf("state %s dispatched %d times without progress", p.stateName(fn), p.guardCount)
+	return true
+}
+
+// RunGrammar runs the grammar given by the named states, starting with entry.
+// The states are known under their names while they run, as if they were
+// wrapped by NameState, even if they are returned by other states.
+// Closures created by the same function literal can't be told apart and
+// remain unnamed in this case.
+func (p *Parser) RunGrammar(states map[string]State, entry string) error {
+	start, has := states[entry]
+	if !has {
+		return fmt.Errorf("unknown state %q", entry)
+	}
+	p.names = map[uintptr]string{}
+	ambiguous := map[uintptr]bool{}
+	for name, s := range states {
+		pc := reflect.ValueOf(s).Pointer()
+		if _, has := p.names[pc]; has {
+			ambiguous[pc] = true
+		}
+		p.names[pc] = name
+	}
+	for pc := range ambiguous {
+		delete(p.names, pc)
+	}
+	return p.Run(start)
+}
+
+// call runs fn under its name in the grammar, if it has one
+func (p *Parser) call(fn State) State {
+	pc := reflect.ValueOf(fn).Pointer()
+	name, has := p.names[pc]
+	if has {
+		p.states = append(p.states, name)
+		defer p.popState()
+	}
+	var named string
+	if pc == namedStatePC {
+		p.nameSlot = &named
+	}
+	if p.trace != nil {
+		pos := p.position()
+		defer func() {
+			switch {
+			case has:
+			case named != "":
+				name = named
+			default:
+				name = stateFunc(fn)
+			}
+			p.traceState(name, pos)
+		}()
+	}
+	next := fn(p)
+	p.lastName = named
+	if has {
+		p.lastName = name
+	}
+	return next
+}
+
+// SetTrace makes the parser write a line to w for each state run by Run,
+// with the name of the state, the position where it started and the input it consumed.
+// The name is the one given to RunGrammar or NameState or the name of the function.
+// A nil w turns tracing off.
+func (p *Parser) SetTrace(w io.Writer) {
+	p.trace = w
+}
+
+// traceState writes the trace line of the state name that started at pos
+func (p *Parser) traceState(name string, pos Position) {
+	var consumed string
+	if begin := pos.Offset - p.discarded; begin >= 0 && begin <= p.pos {
+		consumed = p.input[begin:p.pos]
+	}
+	fmt.Fprintf(p.trace, "%s at line %d, column %d: consumed %q\n", name, pos.Line, pos.Column, consumed)
+}
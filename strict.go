@@ -0,0 +1,49 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// ErrMisuse is wrapped by the errors that report a misuse of the parser, see WithStrict
+var ErrMisuse = errors.New("misuse of the parser")
+
+// ErrInvariant is wrapped by the errors of CheckInvariants for a corrupted state
+var ErrInvariant = errors.New("parser invariant violated")
+
+// misuse records the first misuse and sets it as error, if the parser is strict
+func (p *Parser) misuse(format string, args ...interface{}) {
+	if !p.strict || p.misused != nil {
+		return
+	}
+	p.misused = fmt.Errorf("%w: %s at byte offset %d", ErrMisuse, fmt.Sprintf(format, args...), p.ByteOffset())
+	p.setErr(p.misused)
+}
+
+// CheckInvariants returns an error wrapping ErrInvariant, if the state of the
+// parser is inconsistent, or the first misuse found in strict mode (see WithStrict).
+// It takes time proportional to the kept input, so it is meant for tests,
+// e.g. to be called after each step of a fuzz target.
+func (p *Parser) CheckInvariants() error {
+	if p.misused != nil {
+		return p.misused
+	}
+	switch {
+	case p.start < 0 || p.start > p.pos || p.pos > len(p.input):
+		return fmt.Errorf("%w: start %d and position %d outside of the %d bytes of input", ErrInvariant, p.start, p.pos, len(p.input))
+	case p.pos < len(p.input) && !utf8.RuneStart(p.input[p.pos]):
+		return fmt.Errorf("%w: position %d inside of a rune", ErrInvariant, p.pos)
+	case p.start < len(p.input) && !utf8.RuneStart(p.input[p.start]):
+		return fmt.Errorf("%w: start %d inside of a rune", ErrInvariant, p.start)
+	case len(p.nodeStarts) != len(p.astQueue):
+		return fmt.Errorf("%w: %d node starts for %d nodes", ErrInvariant, len(p.nodeStarts), len(p.astQueue))
+	}
+	if pos := p.positionOf(p.pos); pos.Line != p.line+1 || pos.Column != p.linepos+1 {
+		return fmt.Errorf("%w: line %d, column %d is tracked for line %d, column %d", ErrInvariant, p.line+1, p.linepos+1, pos.Line, pos.Column)
+	}
+	if pos := p.positionOf(p.start); pos.Line != p.startLine+1 || pos.Column != p.startPos+1 {
+		return fmt.Errorf("%w: start line %d, column %d is tracked for line %d, column %d", ErrInvariant, p.startLine+1, p.startPos+1, pos.Line, pos.Column)
+	}
+	return nil
+}
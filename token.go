@@ -0,0 +1,136 @@
+package parser
+
+// TokenKind classifies tokens, its values are defined by the grammar
+type TokenKind int
+
+// Token is a span of the input together with its position
+type Token struct {
+	Kind        TokenKind
+	Value       string
+	StartOffset int    // byte offset of the first byte
+	EndOffset   int    // byte offset behind the last byte
+	Line        int    // line of the first rune, starting with 1
+	Column      int    // column of the first rune, starting with 1
+	File        string // the file of Line and Column, see AddSourceMapping
+}
+
+// Span is the range of the input between two byte offsets
+type Span struct {
+	Start int // byte offset of the first byte
+	End   int // byte offset behind the last byte
+}
+
+// Span returns the range of the input covered by t
+func (t Token) Span() Span {
+	return Span{t.StartOffset, t.EndOffset}
+}
+
+// EmitSpan is like Emit but also returns the byte offsets of the emitted text
+// the offsets refer to the whole input, see Input
+func (p *Parser) EmitSpan() (value string, start, end int) {
+	t := p.emit(0)
+	return t.Value, t.StartOffset, t.EndOffset
+}
+
+// EmitToken emits the pending input as token of the given kind
+func (p *Parser) EmitToken(kind TokenKind) Token {
+	return p.emit(kind)
+}
+
+// emit turns the pending input into a token, starts the next one
+// and reports the token to the OnEmit hook
+func (p *Parser) emit(kind TokenKind) Token {
+	return p.emitTo(kind, p.pos)
+}
+
+// emitTo is like emit, but the token ends at the byte offset end,
+// which must not be behind the current position
+func (p *Parser) emitTo(kind TokenKind, end int) Token {
+	pos := p.StartPos()
+	t := Token{
+		Kind:        kind,
+		Value:       p.input[p.start:end],
+		StartOffset: pos.Offset,
+		EndOffset:   p.discarded + end,
+		Line:        pos.Line,
+		Column:      pos.Column,
+		File:        pos.File,
+	}
+	if end == p.pos {
+		p.Ignore()
+	} else {
+		p.startLine += p.lineBreaks(p.start, end)
+		p.start = end
+		p.startPos = p.column(end)
+		p.compact()
+	}
+	p.stats.Emits++
+	if p.onEmit != nil {
+		p.onEmit(t)
+	}
+	if p.recording {
+		p.tokens = append(p.tokens, t)
+	}
+	if p.tokenCh != nil {
+		var done <-chan struct{}
+		if p.ctx != nil {
+			done = p.ctx.Done()
+		}
+		select {
+		case p.tokenCh <- t:
+		case <-done:
+		}
+	}
+	return t
+}
+
+// RunTokens runs fn in a new goroutine and sends every emitted token over the
+// returned channel, which is closed when the run is finished. Then wait
+// returns the error of Run. The channel must be drained, since the run
+// blocks until each token is received. Tokens emitted after the run,
+// e.g. by Resume, are not sent.
+func (p *Parser) RunTokens(fn State) (tokens <-chan Token, wait func() error) {
+	ch := make(chan Token)
+	done := make(chan error, 1)
+	p.tokenCh = ch
+	go func() {
+		err := p.Run(fn)
+		p.tokenCh = nil
+		close(ch)
+		done <- err
+	}()
+	return ch, func() error {
+		err := <-done
+		done <- err
+		return err
+	}
+}
+
+// RecordTokens makes the parser record all emitted tokens
+// tokens emitted after a checkpoint are dropped again by Rollback
+func (p *Parser) RecordTokens() {
+	p.recording = true
+}
+
+// EmittedTokens returns the tokens emitted since RecordTokens was called
+func (p *Parser) EmittedTokens() []Token {
+	return p.tokens
+}
+
+// Tokenize calls classify until it returns false and returns the collected tokens.
+// Each call of classify should consume and return one token; at the end of the
+// input it should return false. An error set by classify stops the tokenization
+// and is returned.
+func (p *Parser) Tokenize(classify func(p *Parser) (Token, bool)) ([]Token, error) {
+	var tokens []Token
+	for {
+		t, ok := classify(p)
+		if p.failed() || p.err == ErrIncomplete {
+			return tokens, p.err
+		}
+		if !ok {
+			return tokens, nil
+		}
+		tokens = append(tokens, t)
+	}
+}
@@ -0,0 +1,65 @@
+package parser
+
+import "testing"
+
+func TestRunTokensEmitAfterWait(t *testing.T) {
+	p := New("abc", &testNode{})
+	tokens, wait := p.RunTokens(func(p *Parser) State {
+		p.Next()
+		p.Emit()
+		return nil
+	})
+	var values []string
+	for t := range tokens {
+		values = append(values, t.Value)
+	}
+	if err := wait(); err != nil || len(values) != 1 || values[0] != "a" {
+		t.Fatalf("RunTokens sent %q, error %v", values, err)
+	}
+	p.Next()
+	if v := p.Emit(); v != "b" {
+		t.Errorf("Emit after wait = %q", v)
+	}
+}
+
+func TestOrElseDropsTokens(t *testing.T) {
+	primary := func(p *Parser) State {
+		p.Next()
+		p.Emit()
+		p.Errorf("not a number")
+		return nil
+	}
+	fallback := func(p *Parser) State {
+		p.AcceptRun("ab")
+		p.Emit()
+		return nil
+	}
+	p := New("ab", &testNode{})
+	p.RecordTokens()
+	if err := p.Run(OrElse(primary, fallback)); err != nil {
+		t.Fatal(err)
+	}
+	if tokens := p.EmittedTokens(); len(tokens) != 1 || tokens[0].Value != "ab" {
+		t.Errorf("EmittedTokens() = %v, want only the token of the fallback", tokens)
+	}
+}
+
+func TestTokenSourceMapping(t *testing.T) {
+	p := New("a\nbc", &testNode{})
+	if err := p.AddSourceMapping(2, "inc.txt", 10); err != nil {
+		t.Fatal(err)
+	}
+	p.Next()
+	p.EmitToken(1)
+	p.Next()
+	p.Ignore()
+	p.Next()
+	m := p.EmitMarker()
+	tok := p.EmitToken(2)
+	if tok.Line != 10 || tok.Column != 1 || tok.File != "inc.txt" {
+		t.Errorf("token at line %d, column %d of %q, want line 10, column 1 of \"inc.txt\"", tok.Line, tok.Column, tok.File)
+	}
+	if m.Line != 10 || m.Column != 2 || m.File != "inc.txt" {
+		t.Errorf("marker at line %d, column %d of %q, want line 10, column 2 of \"inc.txt\"", m.Line, m.Column, m.File)
+	}
+}
@@ -0,0 +1,50 @@
+package parser
+
+// ChildrenProvider is implemented by nodes that can be traversed by Walk and Transform
+type ChildrenProvider interface {
+	Children() []ASTNode
+}
+
+// ChildSetter is implemented by nodes whose children can be replaced by Transform
+type ChildSetter interface {
+	SetChildren([]ASTNode)
+}
+
+// Walk calls visitor for root and its descendants in depth first order,
+// root has the depth 0. If visitor returns false, the children of the node are skipped.
+// Only the children of ChildrenProviders are visited.
+func Walk(root ASTNode, visitor func(n ASTNode, depth int) bool) {
+	walk(root, 0, visitor)
+}
+
+func walk(n ASTNode, depth int, visitor func(ASTNode, int) bool) {
+	if !visitor(n, depth) {
+		return
+	}
+	if cp, ok := n.(ChildrenProvider); ok {
+		for _, c := range cp.Children() {
+			walk(c, depth+1, visitor)
+		}
+	}
+}
+
+// Transform rewrites the tree below root bottom up: each node is replaced by the
+// result of fn, which gets the node with its children already transformed.
+// If fn returns nil, the node is removed from its parent.
+// The children of a node are only replaced, if it is a ChildSetter.
+// Transform returns the result of fn for root.
+func Transform(root ASTNode, fn func(ASTNode) ASTNode) ASTNode {
+	if cp, ok := root.(ChildrenProvider); ok {
+		if cs, ok := root.(ChildSetter); ok {
+			children := cp.Children()
+			transformed := make([]ASTNode, 0, len(children))
+			for _, c := range children {
+				if t := Transform(c, fn); t != nil {
+					transformed = append(transformed, t)
+				}
+			}
+			cs.SetChildren(transformed)
+		}
+	}
+	return fn(root)
+}